@@ -0,0 +1,156 @@
+// Package batch groups items into batches flushed by size or by age on a
+// timing wheel.
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel"
+	"github.com/welllog/timewheel/timing"
+)
+
+var ErrClosed = errors.New("batch: batcher closed")
+
+// FlushFunc writes out the items collected under key. ctx expires after
+// Config.FlushTimeout.
+type FlushFunc func(ctx context.Context, key interface{}, items []interface{})
+
+// Config configures a Batcher. Zero MaxSize, MaxWait and FlushTimeout mean no
+// limit.
+type Config struct {
+	// MaxSize flushes a batch as soon as it holds this many items.
+	MaxSize int
+	// MaxWait flushes a batch this long after its first item was added.
+	MaxWait time.Duration
+	// FlushTimeout bounds every call of the FlushFunc through its context.
+	FlushTimeout time.Duration
+}
+
+type batch struct {
+	key   interface{}
+	items []interface{}
+	timer timing.Timer
+}
+
+// Batcher collects items per key. A batch filled by Add is flushed in the
+// goroutine of that Add; a batch that ages out is flushed on the wheel. Two
+// batches of the same key may therefore be flushed concurrently.
+type Batcher struct {
+	timing timing.Timing
+	clock  *timewheel.WheelClock
+	cfg    Config
+	flush  FlushFunc
+
+	mu      sync.Mutex
+	batches map[interface{}]*batch
+	closed  bool
+	wg      sync.WaitGroup // 进行中的flush
+}
+
+func New(tw timing.Timing, cfg Config, flush FlushFunc) *Batcher {
+	return &Batcher{
+		timing:  tw,
+		clock:   timewheel.NewWheelClock(tw),
+		cfg:     cfg,
+		flush:   flush,
+		batches: make(map[interface{}]*batch),
+	}
+}
+
+// Add appends item to the batch of key.
+func (b *Batcher) Add(key, item interface{}) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+
+	bt, ok := b.batches[key]
+	if !ok {
+		bt = &batch{key: key}
+		b.batches[key] = bt
+		if b.cfg.MaxWait > 0 {
+			bt.timer = b.timing.AddTask(b.cfg.MaxWait, func() {
+				b.expire(bt)
+			})
+		}
+	}
+	bt.items = append(bt.items, item)
+
+	if b.cfg.MaxSize <= 0 || len(bt.items) < b.cfg.MaxSize {
+		b.mu.Unlock()
+		return nil
+	}
+	b.takeLocked(bt)
+	b.mu.Unlock()
+
+	b.run(bt)
+	return nil
+}
+
+// Len returns the number of pending batches.
+func (b *Batcher) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.batches)
+}
+
+// Close flushes every pending batch and waits for all flushes to return.
+// Add fails with ErrClosed afterwards.
+func (b *Batcher) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	b.closed = true
+	pending := make([]*batch, 0, len(b.batches))
+	for _, bt := range b.batches {
+		b.takeLocked(bt)
+		pending = append(pending, bt)
+	}
+	b.mu.Unlock()
+
+	for _, bt := range pending {
+		b.run(bt)
+	}
+	b.wg.Wait()
+	return nil
+}
+
+func (b *Batcher) expire(bt *batch) {
+	b.mu.Lock()
+	if b.batches[bt.key] != bt {
+		// 已因数量达到上限或Close被取走
+		b.mu.Unlock()
+		return
+	}
+	b.takeLocked(bt)
+	b.mu.Unlock()
+
+	b.run(bt)
+}
+
+// takeLocked detaches bt for flushing. It must be called with b.mu held.
+func (b *Batcher) takeLocked(bt *batch) {
+	delete(b.batches, bt.key)
+	if bt.timer != nil {
+		bt.timer.Stop()
+	}
+	b.wg.Add(1)
+}
+
+func (b *Batcher) run(bt *batch) {
+	defer b.wg.Done()
+
+	ctx := context.Background()
+	if b.cfg.FlushTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = b.clock.WithTimeout(ctx, b.cfg.FlushTimeout)
+		defer cancel()
+	}
+	b.flush(ctx, bt.key, bt.items)
+}
@@ -0,0 +1,105 @@
+package batch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+type flushed struct {
+	key   interface{}
+	items []interface{}
+	at    time.Time
+}
+
+type recorder struct {
+	mu      sync.Mutex
+	flushes []flushed
+}
+
+func (r *recorder) flush(ctx context.Context, key interface{}, items []interface{}) {
+	r.mu.Lock()
+	r.flushes = append(r.flushes, flushed{key: key, items: items, at: time.Now()})
+	r.mu.Unlock()
+}
+
+func (r *recorder) get() []flushed {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]flushed(nil), r.flushes...)
+}
+
+func TestBatcher(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	r := &recorder{}
+	b := New(tw, Config{MaxSize: 3, MaxWait: 30 * time.Millisecond}, r.flush)
+
+	// 数量触发，同时停止该批次的timer
+	b.Add("a", 1)
+	timer := b.batches["a"].timer
+	b.Add("a", 2)
+	b.Add("a", 3)
+	if f := r.get(); len(f) != 1 || f[0].key != "a" || len(f[0].items) != 3 {
+		t.Fatal("full batch must be flushed, got ", f)
+	}
+	if timer.State() != timing.TimerStopped {
+		t.Fatal("size trigger must stop the timer, got ", timer.State())
+	}
+
+	// 时间触发
+	start := time.Now()
+	b.Add("b", 1)
+	b.Add("c", 1)
+	b.Add("c", 2)
+	time.Sleep(60 * time.Millisecond)
+	f := r.get()
+	if len(f) != 3 || b.Len() != 0 {
+		t.Fatal("aged batches must be flushed, got ", f)
+	}
+	for _, fl := range f[1:] {
+		if d := fl.at.Sub(start); d < 30*time.Millisecond {
+			t.Fatal("batch flushed early ", d)
+		}
+	}
+
+	b.Add("d", 1)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f := r.get(); len(f) != 4 || f[3].key != "d" {
+		t.Fatal("close must flush pending batches, got ", f)
+	}
+	if b.Add("d", 2) != ErrClosed || b.Close() != ErrClosed {
+		t.Fatal("closed batcher must report ErrClosed")
+	}
+}
+
+func TestBatcher_FlushTimeout(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	errC := make(chan error, 1)
+	b := New(tw, Config{MaxSize: 1, FlushTimeout: 20 * time.Millisecond},
+		func(ctx context.Context, key interface{}, items []interface{}) {
+			<-ctx.Done()
+			errC <- ctx.Err()
+		})
+
+	start := time.Now()
+	b.Add("a", 1)
+	if err := <-errC; err != context.DeadlineExceeded {
+		t.Fatal("expect DeadlineExceeded, got ", err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond || d > 80*time.Millisecond {
+		t.Fatal("flush timed out after ", d)
+	}
+	b.Close()
+}
@@ -0,0 +1,254 @@
+// Package breaker provides circuit breakers whose state transitions are
+// scheduled on a timing wheel.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = time.Second
+	defaultHalfOpenMax      = 1
+)
+
+var (
+	// ErrOpen is returned while the breaker is open.
+	ErrOpen = errors.New("breaker: open")
+	// ErrTooManyRequests is returned while the breaker is half-open and all of
+	// its probes are in flight.
+	ErrTooManyRequests = errors.New("breaker: too many requests")
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Config configures a Breaker.
+type Config struct {
+	Name string
+	// FailureThreshold is the number of failures within Window that trips the
+	// breaker, 5 by default.
+	FailureThreshold int
+	// Window is how long failures are counted from the first one, without
+	// limit if zero.
+	Window time.Duration
+	// OpenTimeout is how long the breaker stays open after its first trip, 1s
+	// by default. It doubles on every further trip without a recovery in
+	// between, up to MaxOpenTimeout if that is set.
+	OpenTimeout    time.Duration
+	MaxOpenTimeout time.Duration
+	// HalfOpenMax is the number of probes allowed while half-open, all of
+	// which must succeed to close the breaker, 1 by default.
+	HalfOpenMax int
+	// OnStateChange is called on every transition, in order, outside of the
+	// breaker's lock; it must not report a result to the same breaker.
+	OnStateChange func(name string, from, to State)
+}
+
+// Breaker keeps at most one wheel timer, armed for the end of the failure
+// window while closed and for the end of the open period while open.
+type Breaker struct {
+	timing timing.Timing
+	cfg    Config
+
+	mu        sync.Mutex
+	notifyMu  sync.Mutex // 保证状态变化的回调按顺序执行
+	state     State
+	gen       uint64 // 每次状态变化加1, 丢弃上一状态期间请求的结果
+	failures  int
+	probes    int
+	successes int
+	trips     int
+	deadline  time.Time
+	timer     timing.Timer
+	stopped   bool
+}
+
+func New(tw timing.Timing, cfg Config) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaultOpenTimeout
+	}
+	if cfg.HalfOpenMax <= 0 {
+		cfg.HalfOpenMax = defaultHalfOpenMax
+	}
+	return &Breaker{timing: tw, cfg: cfg}
+}
+
+func (b *Breaker) Name() string {
+	return b.cfg.Name
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow asks to make a request. If it is allowed, the result of the request
+// must be reported through done.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.probes >= b.cfg.HalfOpenMax {
+			return nil, ErrTooManyRequests
+		}
+		b.probes++
+	}
+
+	gen := b.gen
+	return func(success bool) {
+		b.done(gen, success)
+	}, nil
+}
+
+// Do runs fn if the breaker allows it and counts a non-nil error as a
+// failure.
+func (b *Breaker) Do(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err == nil)
+	return err
+}
+
+func (b *Breaker) done(gen uint64, success bool) {
+	b.mu.Lock()
+	if gen != b.gen {
+		b.mu.Unlock()
+		return
+	}
+
+	switch b.state {
+	case Closed:
+		if success {
+			b.mu.Unlock()
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.trip()
+			return
+		}
+		if b.failures == 1 && b.cfg.Window > 0 {
+			b.arm(b.cfg.Window)
+		}
+	case HalfOpen:
+		b.probes--
+		if !success {
+			b.trip()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenMax {
+			b.trips = 0
+			if b.timer != nil {
+				b.timer.Stop()
+			}
+			b.setState(Closed)
+			return
+		}
+	}
+	b.mu.Unlock()
+}
+
+// trip opens the breaker. It must be called with b.mu held and releases it.
+func (b *Breaker) trip() {
+	b.trips++
+	d := b.cfg.OpenTimeout
+	for i := 1; i < b.trips && (b.cfg.MaxOpenTimeout <= 0 || d < b.cfg.MaxOpenTimeout); i++ {
+		d *= 2
+	}
+	if b.cfg.MaxOpenTimeout > 0 && d > b.cfg.MaxOpenTimeout {
+		d = b.cfg.MaxOpenTimeout
+	}
+	b.arm(d)
+	b.setState(Open)
+}
+
+// arm moves the timer of the breaker to d from now. It must be called with
+// b.mu held.
+func (b *Breaker) arm(d time.Duration) {
+	if b.stopped {
+		return
+	}
+	b.deadline = time.Now().Add(d)
+	if b.timer == nil {
+		b.timer = b.timing.AddTask(d, b.fire)
+		return
+	}
+	b.timer.Reset(d)
+}
+
+func (b *Breaker) fire() {
+	b.mu.Lock()
+	if b.stopped || time.Now().Before(b.deadline) {
+		// 触发期间被重新计时
+		b.mu.Unlock()
+		return
+	}
+
+	switch b.state {
+	case Open:
+		b.setState(HalfOpen)
+		return
+	case Closed:
+		// 失败窗口结束
+		b.failures = 0
+	}
+	b.mu.Unlock()
+}
+
+// setState must be called with b.mu held and releases it.
+func (b *Breaker) setState(to State) {
+	from := b.state
+	b.state = to
+	b.gen++
+	b.failures, b.probes, b.successes = 0, 0, 0
+
+	b.notifyMu.Lock()
+	b.mu.Unlock()
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(b.cfg.Name, from, to)
+	}
+	b.notifyMu.Unlock()
+}
+
+// stop releases the timer of the breaker.
+func (b *Breaker) stop() {
+	b.mu.Lock()
+	b.stopped = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.mu.Unlock()
+}
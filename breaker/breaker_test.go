@@ -0,0 +1,142 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+var errFail = errors.New("fail")
+
+func fail() error    { return errFail }
+func succeed() error { return nil }
+
+type transitions struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (l *transitions) onStateChange(name string, from, to State) {
+	l.mu.Lock()
+	l.log = append(l.log, fmt.Sprint(name, ":", from, "->", to))
+	l.mu.Unlock()
+}
+
+func (l *transitions) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprint(l.log)
+}
+
+func TestBreaker(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	log := &transitions{}
+	b := New(tw, Config{
+		Name:             "db",
+		FailureThreshold: 3,
+		OpenTimeout:      20 * time.Millisecond,
+		MaxOpenTimeout:   60 * time.Millisecond,
+		OnStateChange:    log.onStateChange,
+	})
+
+	for i := 0; i < 3; i++ {
+		b.Do(fail)
+	}
+	if b.State() != Open || b.Do(succeed) != ErrOpen {
+		t.Fatal("breaker must open after 3 failures, got ", b.State())
+	}
+
+	// 重复跳闸时打开时长翻倍
+	for _, expect := range []time.Duration{20, 40, 60, 60} {
+		start := time.Now()
+		for b.State() == Open {
+			time.Sleep(time.Millisecond)
+		}
+		d := time.Since(start)
+		if d < (expect-2)*time.Millisecond || d > (expect+20)*time.Millisecond {
+			t.Fatal("expect open for ", expect, "ms, got ", d)
+		}
+		done, err := b.Allow()
+		if err != nil {
+			t.Fatal("half-open breaker must allow a probe, got ", err)
+		}
+		if _, err := b.Allow(); err != ErrTooManyRequests {
+			t.Fatal("expect ErrTooManyRequests, got ", err)
+		}
+		done(false)
+	}
+
+	for b.State() == Open {
+		time.Sleep(time.Millisecond)
+	}
+	if b.Do(succeed) != nil || b.State() != Closed {
+		t.Fatal("successful probe must close the breaker, got ", b.State())
+	}
+	if b.trips != 0 {
+		t.Fatal("recovery must reset the open duration")
+	}
+
+	expect := "[db:closed->open db:open->half-open db:half-open->open db:open->half-open db:half-open->open " +
+		"db:open->half-open db:half-open->open db:open->half-open db:half-open->open db:open->half-open db:half-open->closed]"
+	if log.String() != expect {
+		t.Fatal("unexpected transitions ", log)
+	}
+}
+
+func TestBreaker_Window(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	b := New(tw, Config{FailureThreshold: 3, Window: 30 * time.Millisecond})
+	b.Do(fail)
+	b.Do(fail)
+	time.Sleep(50 * time.Millisecond)
+	b.Do(fail)
+	b.Do(fail)
+	if b.State() != Closed {
+		t.Fatal("failures must be reset after the window")
+	}
+	b.Do(fail)
+	if b.State() != Open {
+		t.Fatal("breaker must open after 3 failures in the window")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	log := &transitions{}
+	g := NewGroup(tw, 30*time.Millisecond, Config{FailureThreshold: 1, OpenTimeout: time.Hour, OnStateChange: log.onStateChange})
+	g.Do("a", fail)
+	if g.Do("a", succeed) != ErrOpen || g.Do("b", succeed) != nil {
+		t.Fatal("hosts must have their own breakers")
+	}
+	if log.String() != "[a:closed->open]" || g.Len() != 2 {
+		t.Fatal("unexpected transitions ", log)
+	}
+
+	b := g.Get("a")
+	time.Sleep(60 * time.Millisecond)
+	if g.Len() != 0 {
+		t.Fatal("idle breakers must expire, left ", g.Len())
+	}
+	b.mu.Lock()
+	stopped := b.stopped
+	b.mu.Unlock()
+	if !stopped {
+		t.Fatal("expired breaker must stop its timer")
+	}
+	if g.Do("a", succeed) != nil {
+		t.Fatal("expired breaker must be replaced")
+	}
+}
@@ -0,0 +1,58 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+	"github.com/welllog/timewheel/ttlcache"
+)
+
+// Group keeps one breaker per name, such as per downstream host, and drops
+// the breakers that have not been used for the idle period. idle should
+// exceed the longest open period, or an open breaker could be dropped and
+// replaced by a closed one.
+type Group struct {
+	timing timing.Timing
+	cfg    Config
+	cache  *ttlcache.Cache
+	mu     sync.Mutex
+}
+
+// NewGroup returns a group whose breakers use cfg with their name set.
+func NewGroup(tw timing.Timing, idle time.Duration, cfg Config) *Group {
+	return &Group{
+		timing: tw,
+		cfg:    cfg,
+		cache: ttlcache.New(tw, ttlcache.Config{
+			TTL: idle,
+			OnEvict: func(key, value interface{}, reason ttlcache.EvictReason) {
+				value.(*Breaker).stop()
+			},
+		}),
+	}
+}
+
+// Get returns the breaker of name, creating it if needed.
+func (g *Group) Get(name string) *Breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if v, ok := g.cache.Get(name); ok && g.cache.Touch(name) {
+		return v.(*Breaker)
+	}
+	cfg := g.cfg
+	cfg.Name = name
+	b := New(g.timing, cfg)
+	g.cache.Set(name, b)
+	return b
+}
+
+// Do runs fn through the breaker of name.
+func (g *Group) Do(name string, fn func() error) error {
+	return g.Get(name).Do(fn)
+}
+
+// Len returns the number of breakers in the group.
+func (g *Group) Len() int {
+	return g.cache.Len()
+}
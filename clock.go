@@ -0,0 +1,240 @@
+package timewheel
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/schedule"
+	"github.com/welllog/timewheel/timing"
+)
+
+// Clock lets libraries take timers from the time package, a timing wheel or
+// a fake clock in tests, depending on what the application injects.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	AfterFunc(d time.Duration, f func()) *Timer
+	NewTimer(d time.Duration) *Timer
+	NewTicker(d time.Duration) *Ticker
+	Sleep(d time.Duration)
+}
+
+// StdClock is backed by the time package.
+var StdClock Clock = stdClock{}
+
+type stdClock struct{}
+
+func (stdClock) Now() time.Time {
+	return time.Now()
+}
+
+func (stdClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (stdClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (stdClock) AfterFunc(d time.Duration, f func()) *Timer {
+	return &Timer{timer: time.AfterFunc(d, f)}
+}
+
+func (stdClock) NewTimer(d time.Duration) *Timer {
+	t := time.NewTimer(d)
+	return &Timer{C: t.C, timer: t}
+}
+
+func (stdClock) NewTicker(d time.Duration) *Ticker {
+	return stdClock{}.NewTickerWithPolicy(d, DropTicks())
+}
+
+func (stdClock) NewTickerWithPolicy(d time.Duration, policy TickPolicy) *Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	sender := newTickSender(policy)
+	t := &stdTicker{d: d}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timer = time.AfterFunc(d, func() {
+		t.mu.Lock()
+		if !t.stopped {
+			t.timer.Reset(t.d)
+		}
+		t.mu.Unlock()
+
+		sender.send(time.Now())
+	})
+	return &Ticker{C: sender.c, sender: sender, ticker: t}
+}
+
+func (stdClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// stdTicker 基于time.AfterFunc实现，以便支持Reset
+type stdTicker struct {
+	mu      sync.Mutex
+	d       time.Duration
+	stopped bool
+	timer   *time.Timer
+}
+
+func (t *stdTicker) Stop() {
+	t.mu.Lock()
+	t.stopped = true
+	t.timer.Stop()
+	t.mu.Unlock()
+}
+
+func (t *stdTicker) Reset(d time.Duration) {
+	t.mu.Lock()
+	t.d = d
+	t.stopped = false
+	t.timer.Reset(d)
+	t.mu.Unlock()
+}
+
+// WheelClock is backed by a timing wheel. Now and Since still read the
+// system clock.
+type WheelClock struct {
+	timing timing.Timing
+}
+
+func NewWheelClock(tw timing.Timing) *WheelClock {
+	return &WheelClock{timing: tw}
+}
+
+func (c *WheelClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *WheelClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (c *WheelClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C
+}
+
+func (c *WheelClock) AfterFunc(d time.Duration, f func()) *Timer {
+	return &Timer{timer: c.timing.AddTask(d, f)}
+}
+
+func (c *WheelClock) NewTimer(d time.Duration) *Timer {
+	ch := make(chan time.Time, 1)
+	return &Timer{C: ch, timer: c.timing.AddTask(d, sendTime(ch))}
+}
+
+// TimerAt fires at the deadline t, or immediately if t has passed.
+func (c *WheelClock) TimerAt(t time.Time) *Timer {
+	ch := make(chan time.Time, 1)
+	return &Timer{C: ch, timer: c.timing.AddTaskAt(t, sendTime(ch))}
+}
+
+func (c *WheelClock) AfterAt(t time.Time) <-chan time.Time {
+	return c.TimerAt(t).C
+}
+
+func (c *WheelClock) AfterFuncAt(t time.Time, f func()) *Timer {
+	return &Timer{timer: c.timing.AddTaskAt(t, f)}
+}
+
+func (c *WheelClock) NewTicker(d time.Duration) *Ticker {
+	return c.NewTickerWithPolicy(d, DropTicks())
+}
+
+func (c *WheelClock) NewTickerWithPolicy(d time.Duration, policy TickPolicy) *Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	sender := newTickSender(policy)
+	t := &wheelTicker{s: &defscheduler{delay: int64(d)}}
+	t.timer = c.timing.ScheduleTask(t.s, func() {
+		sender.send(time.Now())
+	})
+	return &Ticker{C: sender.c, sender: sender, ticker: t}
+}
+
+// NewAlignedTicker ticks on the wall-clock boundaries of loc that are a
+// multiple of period plus offset. Ticks are scheduled at a fixed rate, so they
+// stay on the boundaries however long the process runs.
+func (c *WheelClock) NewAlignedTicker(period, offset time.Duration, loc *time.Location) *Ticker {
+	if period <= 0 {
+		panic("non-positive interval for NewAlignedTicker")
+	}
+	sender := newTickSender(DropTicks())
+	t := &alignedTicker{
+		timing: c.timing,
+		offset: offset,
+		loc:    loc,
+		send:   func() { sender.send(time.Now()) },
+	}
+	t.start(period)
+	return &Ticker{C: sender.c, sender: sender, ticker: t}
+}
+
+// NewAlignedTimer fires once on the next boundary NewAlignedTicker would tick on.
+// The boundary is a wall-clock time, so the timer follows steps of the system
+// clock.
+func (c *WheelClock) NewAlignedTimer(period, offset time.Duration, loc *time.Location) *Timer {
+	ch := make(chan time.Time, 1)
+	at := schedule.Align(period, offset, loc).Next(time.Now())
+	return &Timer{C: ch, timer: c.timing.AddWallTask(at, sendTime(ch))}
+}
+
+func (c *WheelClock) Sleep(d time.Duration) {
+	c.SleepContext(context.Background(), d)
+}
+
+// SleepContext pauses for d or until ctx is done, whichever comes first, and
+// returns ctx.Err() in the latter case.
+func (c *WheelClock) SleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	return wait(ctx, c.timing.AddTask(d, func() {}))
+}
+
+// WaitUntil pauses until the deadline t or until ctx is done.
+func (c *WheelClock) WaitUntil(ctx context.Context, t time.Time) error {
+	return wait(ctx, c.timing.AddTaskAt(t, func() {}))
+}
+
+// Timeout runs fn and waits at most d for it to return. When d elapses first
+// Timeout returns context.DeadlineExceeded without waiting for fn; the ctx
+// passed to fn is canceled in every case once Timeout returns.
+func (c *WheelClock) Timeout(ctx context.Context, d time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timer := c.timing.AddTask(d, func() {})
+	defer timer.Stop()
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- fn(ctx)
+	}()
+
+	select {
+	case err := <-errC:
+		return err
+	case <-timer.Done():
+		return context.DeadlineExceeded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func wait(ctx context.Context, t timing.Timer) error {
+	select {
+	case <-t.Done():
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package timewheel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+
+	timer := c.NewTimer(time.Second)
+	ticker := c.NewTicker(300 * time.Millisecond)
+	var calls []time.Time
+	c.AfterFunc(500*time.Millisecond, func() {
+		calls = append(calls, c.Now())
+	})
+
+	c.Add(400 * time.Millisecond)
+	if got := <-ticker.C; !got.Equal(start.Add(300 * time.Millisecond)) {
+		t.Fatal("unexpected tick ", got)
+	}
+	select {
+	case <-timer.C:
+		t.Fatal("run ahead")
+	default:
+	}
+
+	c.Add(700 * time.Millisecond)
+	if len(calls) != 1 || !calls[0].Equal(start.Add(500*time.Millisecond)) {
+		t.Fatal("AfterFunc must run once at its deadline, got ", calls)
+	}
+	if got := <-timer.C; !got.Equal(start.Add(time.Second)) {
+		t.Fatal("unexpected fire time ", got)
+	}
+	if c.Since(start) != 1100*time.Millisecond {
+		t.Fatal("unexpected now ", c.Now())
+	}
+
+	ticker.Stop()
+	if timer.Reset(time.Second) {
+		t.Fatal("reset of a fired timer must return false")
+	}
+	if c.Len() != 1 {
+		t.Fatal("only the reset timer must be pending, got ", c.Len())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(time.Minute)
+		close(done)
+	}()
+	for c.Len() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Add(time.Minute)
+	<-done
+}
+
+func testClock(t *testing.T, c Clock) {
+	start := c.Now()
+	select {
+	case end := <-c.After(50 * time.Millisecond):
+		checkTime(t, start, end, 45*time.Millisecond, 120*time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatal("delay run")
+	}
+
+	fired := make(chan struct{})
+	c.AfterFunc(20*time.Millisecond, func() { close(fired) })
+	<-fired
+
+	timer := c.NewTimer(time.Hour)
+	if !timer.Reset(10*time.Millisecond) || !timer.Reset(20*time.Millisecond) {
+		t.Fatal("reset of an active timer must return true")
+	}
+	<-timer.C
+
+	ticker := c.NewTicker(20 * time.Millisecond)
+	<-ticker.C
+	ticker.Reset(10 * time.Millisecond)
+	<-ticker.C
+	ticker.Stop()
+
+	start = c.Now()
+	c.Sleep(30 * time.Millisecond)
+	checkTime(t, start, c.Now(), 25*time.Millisecond, 120*time.Millisecond)
+}
+
+func TestStdClock(t *testing.T) {
+	testClock(t, StdClock)
+}
+
+func TestWheelClock(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	testClock(t, NewWheelClock(tw))
+}
@@ -0,0 +1,127 @@
+package timewheel
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+// timerCtx is a deadline context whose expiry is a wheel timer. Cancellation
+// of the parent propagates through an inner context.WithCancel.
+type timerCtx struct {
+	context.Context // context.WithCancel(parent)
+	parent          context.Context
+	cancel          context.CancelFunc
+	deadline        time.Time
+	timer           timing.Timer
+
+	mu  sync.Mutex
+	err error
+}
+
+// WithDeadline is context.WithDeadline with the expiry driven by the wheel
+// instead of a runtime timer.
+func (c *WheelClock) WithDeadline(parent context.Context, d time.Time) (context.Context, context.CancelFunc) {
+	ctx := &timerCtx{parent: parent, deadline: d}
+
+	cancelParent := parent
+	if p, ok := parent.(*timerCtx); ok {
+		// 直接挂在父级内部的cancelCtx上，避免context包为传播取消启动goroutine
+		cancelParent = p.Context
+	}
+	ctx.Context, ctx.cancel = context.WithCancel(cancelParent)
+
+	if cur, ok := parent.Deadline(); ok && cur.Before(d) {
+		// 父级先到期，由父级的取消传播完成
+		ctx.deadline = cur
+		return ctx, ctx.stop
+	}
+	if !d.After(time.Now()) {
+		// 已经过期，与context.WithDeadline一样同步取消
+		ctx.expire()
+		return ctx, ctx.stop
+	}
+
+	ctx.mu.Lock()
+	ctx.timer = c.timing.AddTaskAt(d, ctx.expire)
+	ctx.mu.Unlock()
+	return ctx, ctx.stop
+}
+
+// WithTimeout is WithDeadline(parent, time.Now().Add(timeout)).
+func (c *WheelClock) WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return c.WithDeadline(parent, time.Now().Add(timeout))
+}
+
+func (c *timerCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *timerCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = c.innerErr()
+	}
+	return c.err
+}
+
+// Value hides the inner cancel context, so that contexts derived from c by the
+// context package register through AfterFunc and copy Err, reporting
+// DeadlineExceeded rather than the Canceled of the inner context.
+func (c *timerCtx) Value(key interface{}) interface{} {
+	v := c.Context.Value(key)
+	if v == c.Context {
+		return nil
+	}
+	return v
+}
+
+// AfterFunc lets the context package register the children of c on the
+// inner cancel context instead of starting a goroutine per child; they copy
+// the Err of c once it is done.
+func (c *timerCtx) AfterFunc(f func()) func() bool {
+	return context.AfterFunc(c.Context, f)
+}
+
+func (c *timerCtx) String() string {
+	return "timewheel.WithDeadline(" + c.deadline.String() + ")"
+}
+
+// innerErr must be called with c.mu held.
+func (c *timerCtx) innerErr() error {
+	if err := c.Context.Err(); err != nil {
+		if perr := c.parent.Err(); perr != nil {
+			return perr
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *timerCtx) expire() {
+	c.mu.Lock()
+	if c.err == nil {
+		if c.err = c.innerErr(); c.err == nil {
+			c.err = context.DeadlineExceeded
+		}
+	}
+	c.mu.Unlock()
+	c.cancel()
+}
+
+func (c *timerCtx) stop() {
+	c.mu.Lock()
+	if c.err == nil {
+		if c.err = c.innerErr(); c.err == nil {
+			c.err = context.Canceled
+		}
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+	c.cancel()
+}
@@ -0,0 +1,134 @@
+package timewheel
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+func TestWithTimeout(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	parent := context.WithValue(context.Background(), ctxKey{}, "v")
+	start := time.Now()
+	ctx, cancel := WithTimeout(parent, 50*time.Millisecond)
+	defer cancel()
+	child, childCancel := context.WithCancel(ctx)
+	defer childCancel()
+
+	if d, ok := ctx.Deadline(); !ok || d.Sub(start) < 50*time.Millisecond {
+		t.Error("unexpected deadline ", d)
+	}
+	if ctx.Value(ctxKey{}) != "v" {
+		t.Error("value must be inherited from the parent")
+	}
+	if ctx.Err() != nil {
+		t.Error("context must not be done yet")
+	}
+
+	select {
+	case <-ctx.Done():
+		checkTime(t, start, time.Now(), 45*time.Millisecond, 120*time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatal("delay run")
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Error("expect deadline exceeded, got ", ctx.Err())
+	}
+	<-child.Done()
+	if child.Err() != context.DeadlineExceeded {
+		t.Error("child must report deadline exceeded, got ", child.Err())
+	}
+	cancel()
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Error("err must not change after cancel")
+	}
+}
+
+func TestWithDeadline_Cancel(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	parent, parentCancel := context.WithCancel(context.Background())
+	ctx, cancel := WithDeadline(parent, time.Now().Add(time.Hour))
+	defer cancel()
+	parentCancel()
+	<-ctx.Done()
+	if ctx.Err() != context.Canceled {
+		t.Error("parent cancellation must propagate, got ", ctx.Err())
+	}
+
+	ctx, cancel = WithDeadline(context.Background(), time.Now().Add(time.Hour))
+	cancel()
+	<-ctx.Done()
+	if ctx.Err() != context.Canceled {
+		t.Error("expect canceled, got ", ctx.Err())
+	}
+
+	ctx, cancel = WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Error("past deadline must expire synchronously, got ", ctx.Err())
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("done must be closed for a past deadline")
+	}
+}
+
+func TestWithTimeout_Nested(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	parent, cancel := WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	long, longCancel := WithTimeout(parent, time.Hour)
+	defer longCancel()
+	short, shortCancel := WithTimeout(parent, 20*time.Millisecond)
+	defer shortCancel()
+
+	pd, _ := parent.Deadline()
+	if d, _ := long.Deadline(); !d.Equal(pd) {
+		t.Error("deadline must not exceed the parent's")
+	}
+
+	<-short.Done()
+	if short.Err() != context.DeadlineExceeded || parent.Err() != nil {
+		t.Error("only the short context must expire")
+	}
+	<-long.Done()
+	if long.Err() != context.DeadlineExceeded {
+		t.Error("child must inherit the parent's expiry, got ", long.Err())
+	}
+}
+
+func TestWithTimeout_Children(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	ctx, cancel := WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	children := make([]context.Context, 1000)
+	for i := range children {
+		var childCancel context.CancelFunc
+		children[i], childCancel = context.WithCancel(ctx)
+		defer childCancel()
+	}
+	if n := runtime.NumGoroutine() - before; n > 10 {
+		t.Fatal("derived contexts must not start goroutines, started ", n)
+	}
+
+	for _, child := range children {
+		<-child.Done()
+		if child.Err() != context.DeadlineExceeded {
+			t.Fatal("child must report deadline exceeded, got ", child.Err())
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Package debounce provides keyed debouncing and throttling on a timing wheel.
+//
+// Both types keep an entry, with one wheel timer, only while a key is active
+// and drop it once its timer has nothing left to do, so the number of keys
+// seen over time does not grow memory.
+package debounce
+
+import (
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+type debounceEntry struct {
+	fn       func()
+	deadline time.Time
+	timer    timing.Timer
+}
+
+// Debouncer runs the last function passed for a key once the key has been
+// quiet for the wait period.
+type Debouncer struct {
+	timing timing.Timing
+	wait   time.Duration
+
+	mu      sync.Mutex
+	entries map[interface{}]*debounceEntry
+}
+
+func NewDebouncer(tw timing.Timing, wait time.Duration) *Debouncer {
+	return &Debouncer{timing: tw, wait: wait, entries: make(map[interface{}]*debounceEntry)}
+}
+
+// Debounce replaces the pending function of key with fn and restarts the
+// quiet period.
+func (d *Debouncer) Debounce(key interface{}, fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e, ok := d.entries[key]; ok {
+		e.fn = fn
+		e.deadline = time.Now().Add(d.wait)
+		e.timer.Reset(d.wait)
+		return
+	}
+
+	e := &debounceEntry{fn: fn, deadline: time.Now().Add(d.wait)}
+	d.entries[key] = e
+	e.timer = d.timing.AddTask(d.wait, func() {
+		d.fire(key, e)
+	})
+}
+
+// Cancel drops the pending function of key and reports whether there was one.
+func (d *Debouncer) Cancel(key interface{}) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[key]
+	if ok {
+		delete(d.entries, key)
+		e.timer.Stop()
+	}
+	return ok
+}
+
+// Len returns the number of keys with a pending function.
+func (d *Debouncer) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries)
+}
+
+func (d *Debouncer) fire(key interface{}, e *debounceEntry) {
+	d.mu.Lock()
+	if d.entries[key] != e || time.Now().Before(e.deadline) {
+		// 已取消，或触发期间再次调用Debounce，timer已重新计时
+		d.mu.Unlock()
+		return
+	}
+	delete(d.entries, key)
+	fn := e.fn
+	d.mu.Unlock()
+
+	fn()
+}
+
+type throttleOptions struct {
+	leading  bool
+	trailing bool
+}
+
+type ThrottleOption func(*throttleOptions)
+
+// Leading sets whether the first call of a key runs immediately, true by
+// default.
+func Leading(leading bool) ThrottleOption {
+	return func(o *throttleOptions) {
+		o.leading = leading
+	}
+}
+
+// Trailing sets whether the last call made during an interval runs at its
+// end, true by default.
+func Trailing(trailing bool) ThrottleOption {
+	return func(o *throttleOptions) {
+		o.trailing = trailing
+	}
+}
+
+type throttleEntry struct {
+	pending func()
+	timer   timing.Timer
+}
+
+// Throttler runs the functions passed for a key at most once per interval.
+type Throttler struct {
+	timing   timing.Timing
+	interval time.Duration
+	opts     throttleOptions
+
+	mu      sync.Mutex
+	entries map[interface{}]*throttleEntry
+}
+
+func NewThrottler(tw timing.Timing, interval time.Duration, opts ...ThrottleOption) *Throttler {
+	o := throttleOptions{leading: true, trailing: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Throttler{timing: tw, interval: interval, opts: o, entries: make(map[interface{}]*throttleEntry)}
+}
+
+// Throttle runs fn in the calling goroutine if key is outside of an interval
+// and leading calls are enabled, and reports whether it did. Otherwise fn
+// becomes the trailing call of the current interval, if trailing calls are
+// enabled, and runs on the wheel when the interval ends.
+func (th *Throttler) Throttle(key interface{}, fn func()) bool {
+	th.mu.Lock()
+	if e, ok := th.entries[key]; ok {
+		if th.opts.trailing {
+			e.pending = fn
+		}
+		th.mu.Unlock()
+		return false
+	}
+
+	e := &throttleEntry{}
+	if !th.opts.leading {
+		if !th.opts.trailing {
+			th.mu.Unlock()
+			return false
+		}
+		e.pending = fn
+	}
+	th.entries[key] = e
+	e.timer = th.timing.AddTask(th.interval, func() {
+		th.fire(key, e)
+	})
+	th.mu.Unlock()
+
+	if th.opts.leading {
+		fn()
+		return true
+	}
+	return false
+}
+
+// Cancel ends the current interval of key, dropping its trailing call, and
+// reports whether key was in an interval.
+func (th *Throttler) Cancel(key interface{}) bool {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	e, ok := th.entries[key]
+	if ok {
+		delete(th.entries, key)
+		e.timer.Stop()
+	}
+	return ok
+}
+
+// Len returns the number of keys in an interval.
+func (th *Throttler) Len() int {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return len(th.entries)
+}
+
+func (th *Throttler) fire(key interface{}, e *throttleEntry) {
+	th.mu.Lock()
+	if th.entries[key] != e {
+		th.mu.Unlock()
+		return
+	}
+	fn := e.pending
+	if fn == nil {
+		delete(th.entries, key)
+		th.mu.Unlock()
+		return
+	}
+	// 尾部调用开启新的周期
+	e.pending = nil
+	e.timer.Reset(th.interval)
+	th.mu.Unlock()
+
+	fn()
+}
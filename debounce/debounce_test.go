@@ -0,0 +1,84 @@
+package debounce
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+func TestDebouncer(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	d := NewDebouncer(tw, 20*time.Millisecond)
+	var runs, last int32
+	for i := 1; i <= 5; i++ {
+		i := int32(i)
+		d.Debounce("a", func() {
+			atomic.AddInt32(&runs, 1)
+			atomic.StoreInt32(&last, i)
+		})
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&runs) != 0 {
+		t.Fatal("debounced call ran before the quiet period")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != 1 || atomic.LoadInt32(&last) != 5 {
+		t.Fatal("expect the last call to run once, runs ", runs, " last ", last)
+	}
+	if d.Len() != 0 {
+		t.Fatal("fired key must be dropped")
+	}
+
+	d.Debounce("b", func() { t.Error("canceled call ran") })
+	if !d.Cancel("b") || d.Cancel("b") || d.Len() != 0 {
+		t.Fatal("cancel must drop the key")
+	}
+	time.Sleep(40 * time.Millisecond)
+}
+
+func TestThrottler(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	cases := []struct {
+		opts   []ThrottleOption
+		expect []int32
+	}{
+		{nil, []int32{1, 10}},
+		{[]ThrottleOption{Trailing(false)}, []int32{1}},
+		{[]ThrottleOption{Leading(false)}, []int32{10}},
+	}
+	for _, c := range cases {
+		th := NewThrottler(tw, 50*time.Millisecond, c.opts...)
+		runs := make(chan int32, 10)
+		for i := int32(1); i <= 10; i++ {
+			i := i
+			th.Throttle("a", func() { runs <- i })
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		time.Sleep(150 * time.Millisecond)
+		var got []int32
+		for len(runs) > 0 {
+			got = append(got, <-runs)
+		}
+		if len(got) != len(c.expect) {
+			t.Fatal("expect runs ", c.expect, " got ", got)
+		}
+		for i := range got {
+			if got[i] != c.expect[i] {
+				t.Fatal("expect runs ", c.expect, " got ", got)
+			}
+		}
+		if th.Len() != 0 {
+			t.Fatal("idle key must be dropped")
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package timewheel
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock for tests. Time only moves through Add and Set, which
+// run due AfterFunc callbacks synchronously and deliver due ticks and timers
+// before returning.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+type fakeTimer struct {
+	c      *FakeClock
+	when   time.Time
+	period time.Duration
+	fn     func(now time.Time)
+	active bool
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) *Timer {
+	return &Timer{timer: c.add(d, 0, func(time.Time) { f() })}
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) *Timer {
+	ch := make(chan time.Time, 1)
+	return &Timer{C: ch, timer: c.add(d, 0, sendFakeTime(ch))}
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) *Ticker {
+	return c.NewTickerWithPolicy(d, DropTicks())
+}
+
+func (c *FakeClock) NewTickerWithPolicy(d time.Duration, policy TickPolicy) *Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	sender := newTickSender(policy)
+	return &Ticker{C: sender.c, sender: sender, ticker: &fakeTicker{t: c.add(d, d, sender.send)}}
+}
+
+// Sleep blocks until another goroutine advances the clock by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Add advances the clock by d.
+func (c *FakeClock) Add(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to now, firing every timer due on the way in order.
+func (c *FakeClock) Set(now time.Time) {
+	for {
+		c.mu.Lock()
+		t := c.earliest()
+		if t == nil || t.when.After(now) {
+			if now.After(c.now) {
+				c.now = now
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.remove(t)
+		}
+		fired := c.now
+		c.mu.Unlock()
+
+		t.fn(fired)
+	}
+}
+
+// Len returns the number of pending timers and tickers.
+func (c *FakeClock) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (c *FakeClock) add(d, period time.Duration, fn func(time.Time)) *fakeTimer {
+	t := &fakeTimer{c: c, period: period, fn: fn}
+	c.mu.Lock()
+	t.when = c.now.Add(d)
+	t.active = true
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+	return t
+}
+
+func (c *FakeClock) earliest() *fakeTimer {
+	var e *fakeTimer
+	for _, t := range c.timers {
+		if e == nil || t.when.Before(e.when) {
+			e = t
+		}
+	}
+	return e
+}
+
+func (c *FakeClock) remove(t *fakeTimer) {
+	t.active = false
+	for i, ft := range c.timers {
+		if ft == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	active := t.active
+	if active {
+		t.c.remove(t)
+	}
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	active := t.active
+	t.when = t.c.now.Add(d)
+	if !active {
+		t.active = true
+		t.c.timers = append(t.c.timers, t)
+	}
+	return active
+}
+
+type fakeTicker struct {
+	t *fakeTimer
+}
+
+func (t *fakeTicker) Stop() {
+	t.t.Stop()
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	t.t.c.mu.Lock()
+	t.t.period = d
+	t.t.c.mu.Unlock()
+	t.t.Reset(d)
+}
+
+func sendFakeTime(c chan time.Time) func(time.Time) {
+	return func(now time.Time) {
+		select {
+		case c <- now:
+		default:
+		}
+	}
+}
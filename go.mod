@@ -1,3 +1,3 @@
 module github.com/welllog/timewheel
 
-go 1.14
+go 1.21
@@ -0,0 +1,211 @@
+// Package heartbeat detects entities that stop sending heartbeats, keeping one
+// wheel timer per entity.
+package heartbeat
+
+import (
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+const defaultDeadAfter = 3
+
+type State int
+
+const (
+	Alive State = iota
+	// Suspect means at least one interval passed without a heartbeat.
+	Suspect
+	// Dead means DeadAfter intervals passed without a heartbeat.
+	Dead
+)
+
+func (s State) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	}
+	return "unknown"
+}
+
+// Config configures a Monitor. The callbacks of one entity are called in
+// order, outside of the monitor's locks; a callback must not call Beat for
+// the entity it is reporting on, as that would wait for the callback itself.
+type Config struct {
+	// Interval is the expected heartbeat interval of entities added by Beat.
+	Interval time.Duration
+	// DeadAfter is the number of missed intervals after which an entity is
+	// dead, 3 by default.
+	DeadAfter int
+	OnSuspect func(id string)
+	OnDead    func(id string)
+	// OnRecover is called when a suspect or dead entity beats again.
+	OnRecover func(id string)
+}
+
+type Monitor struct {
+	timing timing.Timing
+	cfg    Config
+
+	mu       sync.RWMutex
+	entities map[string]*entity
+}
+
+type entity struct {
+	id       string
+	interval time.Duration
+
+	mu       sync.Mutex
+	notifyMu sync.Mutex // 保证同一实体的回调按状态变化的顺序执行
+	last     time.Time
+	state    State
+	removed  bool
+	timer    timing.Timer
+}
+
+func NewMonitor(tw timing.Timing, cfg Config) *Monitor {
+	if cfg.DeadAfter <= 0 {
+		cfg.DeadAfter = defaultDeadAfter
+	}
+	return &Monitor{timing: tw, cfg: cfg, entities: make(map[string]*entity)}
+}
+
+// Add starts watching id with the given heartbeat interval, counting the call
+// as its first heartbeat. Adding a watched id changes its interval and beats.
+func (m *Monitor) Add(id string, interval time.Duration) {
+	m.mu.Lock()
+	e, ok := m.entities[id]
+	if !ok {
+		e = &entity{id: id, interval: interval, last: time.Now()}
+		m.entities[id] = e
+		e.mu.Lock()
+		e.timer = m.timing.AddTask(interval, func() {
+			m.check(e)
+		})
+		e.mu.Unlock()
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+
+	e.mu.Lock()
+	e.interval = interval
+	m.beat(e)
+}
+
+// Beat records a heartbeat of id, watching it with Config.Interval if it is
+// not watched yet.
+func (m *Monitor) Beat(id string) {
+	m.mu.RLock()
+	e, ok := m.entities[id]
+	m.mu.RUnlock()
+	if !ok {
+		m.Add(id, m.cfg.Interval)
+		return
+	}
+
+	e.mu.Lock()
+	m.beat(e)
+}
+
+// beat must be called with e.mu held and releases it.
+func (m *Monitor) beat(e *entity) {
+	if e.removed {
+		e.mu.Unlock()
+		return
+	}
+	e.last = time.Now()
+	e.timer.Reset(e.interval)
+	if e.state == Alive {
+		e.mu.Unlock()
+		return
+	}
+
+	e.state = Alive
+	e.notifyMu.Lock()
+	e.mu.Unlock()
+	if m.cfg.OnRecover != nil {
+		m.cfg.OnRecover(e.id)
+	}
+	e.notifyMu.Unlock()
+}
+
+// Remove stops watching id and reports whether it was watched.
+func (m *Monitor) Remove(id string) bool {
+	m.mu.Lock()
+	e, ok := m.entities[id]
+	delete(m.entities, id)
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	e.mu.Lock()
+	e.removed = true
+	e.timer.Stop()
+	e.mu.Unlock()
+	return true
+}
+
+// State returns the state of id.
+func (m *Monitor) State(id string) (State, bool) {
+	m.mu.RLock()
+	e, ok := m.entities[id]
+	m.mu.RUnlock()
+	if !ok {
+		return Alive, false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state, true
+}
+
+func (m *Monitor) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.entities)
+}
+
+func (m *Monitor) check(e *entity) {
+	e.mu.Lock()
+	if e.removed {
+		e.mu.Unlock()
+		return
+	}
+
+	elapsed := time.Since(e.last)
+	deadAt := time.Duration(m.cfg.DeadAfter) * e.interval
+	from := e.state
+	switch {
+	case elapsed >= deadAt:
+		e.state = Dead
+	case elapsed >= e.interval:
+		e.state = Suspect
+		e.timer.Reset(deadAt - elapsed)
+	default:
+		// 触发期间收到心跳，timer已重新计时
+		e.mu.Unlock()
+		return
+	}
+	if e.state == from {
+		e.mu.Unlock()
+		return
+	}
+
+	to := e.state
+	e.notifyMu.Lock()
+	e.mu.Unlock()
+	if from == Alive && m.cfg.OnSuspect != nil {
+		m.cfg.OnSuspect(e.id)
+	}
+	if to == Dead && m.cfg.OnDead != nil {
+		m.cfg.OnDead(e.id)
+	}
+	e.notifyMu.Unlock()
+}
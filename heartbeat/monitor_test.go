@@ -0,0 +1,99 @@
+package heartbeat
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(kind string) func(id string) {
+	return func(id string) {
+		l.mu.Lock()
+		l.events = append(l.events, kind+":"+id)
+		l.mu.Unlock()
+	}
+}
+
+func (l *eventLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprint(l.events)
+}
+
+func TestMonitor(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	log := &eventLog{}
+	m := NewMonitor(tw, Config{
+		Interval:  20 * time.Millisecond,
+		DeadAfter: 3,
+		OnSuspect: log.add("suspect"),
+		OnDead:    log.add("dead"),
+		OnRecover: log.add("recover"),
+	})
+
+	m.Beat("a")
+	m.Beat("b")
+	for i := 0; i < 8; i++ {
+		time.Sleep(10 * time.Millisecond)
+		m.Beat("a")
+	}
+	if s, _ := m.State("a"); s != Alive {
+		t.Fatal("beating entity must be alive, got ", s)
+	}
+	if s, _ := m.State("b"); s != Dead {
+		t.Fatal("silent entity must be dead, got ", s)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if s, _ := m.State("a"); s != Suspect {
+		t.Fatal("entity must be suspect after a missed interval, got ", s)
+	}
+	m.Beat("a")
+	m.Beat("b")
+	if log.String() != "[suspect:b dead:b suspect:a recover:a recover:b]" {
+		t.Fatal("unexpected events ", log)
+	}
+
+	if !m.Remove("a") || m.Remove("a") || m.Len() != 1 {
+		t.Fatal("remove must report whether the entity was watched")
+	}
+	time.Sleep(70 * time.Millisecond)
+	if log.String() != "[suspect:b dead:b suspect:a recover:a recover:b suspect:b dead:b]" {
+		t.Fatal("removed entity must not be reported, got ", log)
+	}
+}
+
+func TestMonitor_Many(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	var mu sync.Mutex
+	dead := 0
+	m := NewMonitor(tw, Config{Interval: 10 * time.Millisecond, DeadAfter: 2, OnDead: func(string) {
+		mu.Lock()
+		dead++
+		mu.Unlock()
+	}})
+	for i := 0; i < 10000; i++ {
+		m.Beat(fmt.Sprint(i))
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if dead != 10000 {
+		t.Fatal("expect every entity to be dead, got ", dead)
+	}
+}
@@ -0,0 +1,212 @@
+// Package httpx provides HTTP middleware driven by a timing wheel.
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/welllog/timewheel"
+	"github.com/welllog/timewheel/timing"
+)
+
+const defaultTimeoutBody = "<html><head><title>Timeout</title></head><body><h1>Timeout</h1></body></html>"
+
+// Config configures the timeout middleware.
+type Config struct {
+	Timeout time.Duration
+	// Code and Body form the response written once Timeout has passed,
+	// http.StatusServiceUnavailable and a short HTML page by default.
+	Code int
+	Body string
+	// OnLate, if set, is called when a handler returns after its timeout
+	// response has been written, with how long it overran the deadline.
+	OnLate func(r *http.Request, late time.Duration)
+}
+
+// Stats counts the requests served by a TimeoutHandler.
+type Stats struct {
+	Requests uint64
+	TimedOut uint64
+	// Late counts the timed out handlers that have since returned, LateTotal
+	// and LateMax how long they overran the deadline.
+	Late      uint64
+	LateTotal time.Duration
+	LateMax   time.Duration
+}
+
+// TimeoutHandler is http.TimeoutHandler with the deadline of every request
+// kept on a timing wheel instead of a runtime timer. The request context
+// handed to the inner handler expires at the deadline.
+type TimeoutHandler struct {
+	handler http.Handler
+	clock   *timewheel.WheelClock
+	cfg     Config
+
+	requests  uint64
+	timedOut  uint64
+	late      uint64
+	lateTotal int64
+	lateMax   int64
+}
+
+// Timeout returns a TimeoutHandler running h with the deadline of cfg.
+func Timeout(tw timing.Timing, h http.Handler, cfg Config) *TimeoutHandler {
+	if cfg.Code == 0 {
+		cfg.Code = http.StatusServiceUnavailable
+	}
+	if cfg.Body == "" {
+		cfg.Body = defaultTimeoutBody
+	}
+	return &TimeoutHandler{handler: h, clock: timewheel.NewWheelClock(tw), cfg: cfg}
+}
+
+// Stats returns a snapshot of the counters.
+func (th *TimeoutHandler) Stats() Stats {
+	return Stats{
+		Requests:  atomic.LoadUint64(&th.requests),
+		TimedOut:  atomic.LoadUint64(&th.timedOut),
+		Late:      atomic.LoadUint64(&th.late),
+		LateTotal: time.Duration(atomic.LoadInt64(&th.lateTotal)),
+		LateMax:   time.Duration(atomic.LoadInt64(&th.lateMax)),
+	}
+}
+
+func (th *TimeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddUint64(&th.requests, 1)
+	ctx, cancel := th.clock.WithTimeout(r.Context(), th.cfg.Timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	done := make(chan struct{})
+	tw := &timeoutWriter{w: w, h: make(http.Header)}
+	panicChan := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicChan <- p
+			}
+		}()
+		th.handler.ServeHTTP(tw, r)
+
+		// 在tw.mu下与超时分支只判定一次: 要么按时完成，要么超时后迟到
+		tw.mu.Lock()
+		timedOut := tw.timedOut
+		tw.finished = !timedOut
+		tw.mu.Unlock()
+		close(done)
+
+		if timedOut {
+			deadline, _ := ctx.Deadline()
+			th.recordLate(r, time.Since(deadline))
+		}
+	}()
+
+	select {
+	case p := <-panicChan:
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.flushLocked()
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		if tw.finished {
+			// handler与超时同时结束，按时完成
+			tw.flushLocked()
+			return
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			atomic.AddUint64(&th.timedOut, 1)
+			tw.timedOut = true
+			w.WriteHeader(th.cfg.Code)
+			io.WriteString(w, th.cfg.Body)
+			tw.err = http.ErrHandlerTimeout
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			tw.err = ctx.Err()
+		}
+	}
+}
+
+func (th *TimeoutHandler) recordLate(r *http.Request, late time.Duration) {
+	atomic.AddUint64(&th.late, 1)
+	atomic.AddInt64(&th.lateTotal, int64(late))
+	for {
+		max := atomic.LoadInt64(&th.lateMax)
+		if int64(late) <= max || atomic.CompareAndSwapInt64(&th.lateMax, max, int64(late)) {
+			break
+		}
+	}
+	if th.cfg.OnLate != nil {
+		th.cfg.OnLate(r, late)
+	}
+}
+
+// timeoutWriter buffers the response of the inner handler until it returns
+// in time.
+type timeoutWriter struct {
+	w    http.ResponseWriter
+	h    http.Header
+	wbuf bytes.Buffer
+
+	mu          sync.Mutex
+	err         error
+	timedOut    bool
+	finished    bool // handler在超时前返回
+	wroteHeader bool
+	code        int
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.err != nil {
+		return 0, tw.err
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.wbuf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if code < 100 || code > 999 {
+		panic(fmt.Sprintf("invalid WriteHeader code %v", code))
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(code)
+}
+
+// flushLocked writes the buffered response out. It must be called with tw.mu
+// held.
+func (tw *timeoutWriter) flushLocked() {
+	dst := tw.w.Header()
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+	if !tw.wroteHeader {
+		tw.code = http.StatusOK
+	}
+	tw.w.WriteHeader(tw.code)
+	tw.w.Write(tw.wbuf.Bytes())
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.err != nil || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.code = code
+}
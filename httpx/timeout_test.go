@@ -0,0 +1,101 @@
+package httpx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	lateC := make(chan time.Duration, 1)
+	handlerErr := make(chan error, 1)
+	h := Timeout(tw, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			time.Sleep(20 * time.Millisecond)
+			_, err := io.WriteString(w, "late")
+			handlerErr <- err
+			return
+		}
+		w.Header().Set("X-Test", "1")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "ok")
+	}), Config{
+		Timeout: 30 * time.Millisecond,
+		Code:    http.StatusGatewayTimeout,
+		Body:    "timeout",
+		OnLate: func(r *http.Request, late time.Duration) {
+			lateC <- late
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/fast", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != "ok" || rec.Header().Get("X-Test") != "1" {
+		t.Fatal("unexpected response ", rec.Code, rec.Body.String())
+	}
+
+	start := time.Now()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+	if d := time.Since(start); d < 30*time.Millisecond || d > 100*time.Millisecond {
+		t.Fatal("timeout response written after ", d)
+	}
+	if rec.Code != http.StatusGatewayTimeout || rec.Body.String() != "timeout" {
+		t.Fatal("unexpected timeout response ", rec.Code, rec.Body.String())
+	}
+	if err := <-handlerErr; err != http.ErrHandlerTimeout {
+		t.Fatal("late write must fail with ErrHandlerTimeout, got ", err)
+	}
+
+	select {
+	case late := <-lateC:
+		if late < 15*time.Millisecond {
+			t.Fatal("unexpected late duration ", late)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("late request not reported")
+	}
+
+	s := h.Stats()
+	if s.Requests != 2 || s.TimedOut != 1 || s.Late != 1 || s.LateMax <= 0 || s.LateTotal != s.LateMax {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestTimeoutHandler_StatsConsistent(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	// handler在到期的同时返回，超时与迟到必须一一对应
+	h := Timeout(tw, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		io.WriteString(w, "ok")
+	}), Config{Timeout: time.Millisecond})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}()
+	}
+	wg.Wait()
+	time.Sleep(20 * time.Millisecond)
+
+	s := h.Stats()
+	if s.Requests != 200 || s.TimedOut != s.Late {
+		t.Fatalf("timed out and late requests must match %+v", s)
+	}
+}
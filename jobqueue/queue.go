@@ -0,0 +1,319 @@
+// Package jobqueue is an in-process message queue with delayed delivery,
+// visibility timeouts and redelivery, in the manner of SQS, timed by a
+// timing wheel.
+package jobqueue
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+const defaultVisibility = 30 * time.Second
+
+var (
+	ErrClosed = errors.New("jobqueue: queue closed")
+	// ErrInvalidReceipt is returned by Ack and Nack of a delivery whose
+	// visibility timeout has passed or that has already been settled.
+	ErrInvalidReceipt = errors.New("jobqueue: invalid receipt")
+)
+
+// Config configures a Queue.
+type Config struct {
+	// Visibility is how long a received message stays hidden from other
+	// receivers when Receive is not given one, 30s by default.
+	Visibility time.Duration
+	// MaxReceives is the number of receives after which a message that comes
+	// back, by Nack or by its visibility timeout, is dead-lettered instead.
+	// Zero means no limit.
+	MaxReceives int
+	// DeadLetter receives the dead-lettered messages; they are dropped if it
+	// is nil.
+	DeadLetter *Queue
+}
+
+type messageState int
+
+const (
+	stateDelayed messageState = iota
+	stateReady
+	stateInFlight
+)
+
+type message struct {
+	id       uint64
+	body     interface{}
+	receives int
+	receipt  uint64
+	state    messageState
+	deadline time.Time
+	timer    timing.Timer
+}
+
+type waiter struct {
+	visibility time.Duration
+	c          chan struct{}
+	d          *Delivery
+	err        error
+}
+
+// Queue keeps one wheel timer per message, armed for the end of its delay
+// while delayed and for the end of its visibility timeout while in flight.
+type Queue struct {
+	timing timing.Timing
+	cfg    Config
+
+	mu       sync.Mutex
+	messages map[uint64]*message
+	ready    *list.List // *message, 按就绪顺序
+	waiters  *list.List // *waiter, 按调用Receive的顺序
+	nextID   uint64
+	receipts uint64
+	closed   bool
+}
+
+func New(tw timing.Timing, cfg Config) *Queue {
+	if cfg.Visibility <= 0 {
+		cfg.Visibility = defaultVisibility
+	}
+	return &Queue{
+		timing:   tw,
+		cfg:      cfg,
+		messages: make(map[uint64]*message),
+		ready:    list.New(),
+		waiters:  list.New(),
+	}
+}
+
+// Delivery is a received message. It must be settled with Ack or Nack before
+// its visibility timeout, or the message is delivered again.
+type Delivery struct {
+	ID   uint64
+	Body interface{}
+	// ReceiveCount counts the receives of the message, this one included.
+	ReceiveCount int
+
+	q       *Queue
+	receipt uint64
+}
+
+// Ack removes the message from the queue.
+func (d *Delivery) Ack() error {
+	return d.q.settle(d, false, 0)
+}
+
+// Nack returns the message to the queue, to be delivered again after delay.
+func (d *Delivery) Nack(delay time.Duration) error {
+	return d.q.settle(d, true, delay)
+}
+
+// Send adds a message that becomes receivable after delay and returns its ID.
+func (q *Queue) Send(body interface{}, delay time.Duration) (uint64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, ErrClosed
+	}
+
+	q.nextID++
+	m := &message{id: q.nextID, body: body}
+	q.messages[m.id] = m
+	if delay > 0 {
+		m.state = stateDelayed
+		q.arm(m, delay)
+	} else {
+		q.readyLocked(m)
+	}
+	return m.id, nil
+}
+
+// Receive returns the next ready message, hidden from other receivers for
+// visibility, or for Config.Visibility if it is not positive. It blocks until
+// a message is ready, ctx is done or the queue is closed; receivers blocked
+// together are served in order.
+func (q *Queue) Receive(ctx context.Context, visibility time.Duration) (*Delivery, error) {
+	if visibility <= 0 {
+		visibility = q.cfg.Visibility
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if e := q.ready.Front(); e != nil {
+		d := q.deliverLocked(q.ready.Remove(e).(*message), visibility)
+		q.mu.Unlock()
+		return d, nil
+	}
+	w := &waiter{visibility: visibility, c: make(chan struct{})}
+	el := q.waiters.PushBack(w)
+	q.mu.Unlock()
+
+	select {
+	case <-w.c:
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w.d != nil {
+		return w.d, nil
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	q.waiters.Remove(el)
+	return nil, ctx.Err()
+}
+
+// Stats returns the number of messages in each state.
+func (q *Queue) Stats() (delayed, ready, inFlight int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, m := range q.messages {
+		switch m.state {
+		case stateDelayed:
+			delayed++
+		case stateReady:
+			ready++
+		case stateInFlight:
+			inFlight++
+		}
+	}
+	return
+}
+
+// Close drops every message, stops their timers and fails blocked and later
+// calls with ErrClosed.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.closed = true
+
+	for _, m := range q.messages {
+		if m.timer != nil {
+			m.timer.Stop()
+		}
+	}
+	q.messages = nil
+	q.ready.Init()
+	for e := q.waiters.Front(); e != nil; e = e.Next() {
+		w := e.Value.(*waiter)
+		w.err = ErrClosed
+		close(w.c)
+	}
+	q.waiters.Init()
+	return nil
+}
+
+func (q *Queue) settle(d *Delivery, requeue bool, delay time.Duration) error {
+	q.mu.Lock()
+	m, ok := q.messages[d.ID]
+	if !ok || m.state != stateInFlight || m.receipt != d.receipt {
+		err := ErrInvalidReceipt
+		if q.closed {
+			err = ErrClosed
+		}
+		q.mu.Unlock()
+		return err
+	}
+
+	if !requeue {
+		delete(q.messages, m.id)
+		m.timer.Stop()
+		q.mu.Unlock()
+		return nil
+	}
+
+	dead := q.requeueLocked(m, delay)
+	q.mu.Unlock()
+
+	q.deadLetter(dead)
+	return nil
+}
+
+func (q *Queue) fire(m *message) {
+	q.mu.Lock()
+	if q.closed || q.messages[m.id] != m || time.Now().Before(m.deadline) {
+		// 已确认，或触发期间被重新计时
+		q.mu.Unlock()
+		return
+	}
+
+	var dead *message
+	switch m.state {
+	case stateDelayed:
+		q.readyLocked(m)
+	case stateInFlight:
+		// 可见性超时，重新投递
+		dead = q.requeueLocked(m, 0)
+	}
+	q.mu.Unlock()
+
+	q.deadLetter(dead)
+}
+
+// requeueLocked returns m to the queue after delay, or removes and returns it
+// if it has been received too many times.
+func (q *Queue) requeueLocked(m *message, delay time.Duration) *message {
+	if q.cfg.MaxReceives > 0 && m.receives >= q.cfg.MaxReceives {
+		delete(q.messages, m.id)
+		m.timer.Stop()
+		return m
+	}
+	if delay > 0 {
+		m.state = stateDelayed
+		q.arm(m, delay)
+		return nil
+	}
+	q.readyLocked(m)
+	return nil
+}
+
+// readyLocked hands m to the first blocked receiver, or queues it.
+func (q *Queue) readyLocked(m *message) {
+	if e := q.waiters.Front(); e != nil {
+		w := q.waiters.Remove(e).(*waiter)
+		w.d = q.deliverLocked(m, w.visibility)
+		close(w.c)
+		return
+	}
+	m.state = stateReady
+	q.ready.PushBack(m)
+}
+
+func (q *Queue) deliverLocked(m *message, visibility time.Duration) *Delivery {
+	m.receives++
+	q.receipts++
+	m.receipt = q.receipts
+	m.state = stateInFlight
+	q.arm(m, visibility)
+	return &Delivery{ID: m.id, Body: m.body, ReceiveCount: m.receives, q: q, receipt: m.receipt}
+}
+
+// arm moves the timer of m to d from now. It must be called with q.mu held.
+func (q *Queue) arm(m *message, d time.Duration) {
+	m.deadline = time.Now().Add(d)
+	if m.timer == nil {
+		m.timer = q.timing.AddTask(d, func() {
+			q.fire(m)
+		})
+		return
+	}
+	m.timer.Reset(d)
+}
+
+func (q *Queue) deadLetter(m *message) {
+	if m == nil || q.cfg.DeadLetter == nil {
+		return
+	}
+	q.cfg.DeadLetter.Send(m.body, 0)
+}
@@ -0,0 +1,128 @@
+package jobqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+func TestQueue_Delay(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	q := New(tw, Config{})
+	defer q.Close()
+
+	start := time.Now()
+	q.Send("late", 30*time.Millisecond)
+	q.Send("now", 0)
+	if delayed, ready, _ := q.Stats(); delayed != 1 || ready != 1 {
+		t.Fatal("unexpected stats ", delayed, ready)
+	}
+
+	ctx := context.Background()
+	d, err := q.Receive(ctx, 0)
+	if err != nil || d.Body != "now" || d.ReceiveCount != 1 {
+		t.Fatal("unexpected delivery ", d, err)
+	}
+	d.Ack()
+
+	d, err = q.Receive(ctx, 0)
+	if err != nil || d.Body != "late" {
+		t.Fatal("unexpected delivery ", d, err)
+	}
+	if el := time.Since(start); el < 30*time.Millisecond || el > 80*time.Millisecond {
+		t.Fatal("delayed message received after ", el)
+	}
+	if d.Ack() != nil || d.Ack() != ErrInvalidReceipt {
+		t.Fatal("a delivery must be acked once")
+	}
+	if delayed, ready, inFlight := q.Stats(); delayed+ready+inFlight != 0 {
+		t.Fatal("acked messages must be removed")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.Receive(ctx, 0); err != context.DeadlineExceeded {
+		t.Fatal("expect DeadlineExceeded, got ", err)
+	}
+}
+
+func TestQueue_Redelivery(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	dlq := New(tw, Config{})
+	defer dlq.Close()
+	q := New(tw, Config{MaxReceives: 3, DeadLetter: dlq})
+	defer q.Close()
+
+	ctx := context.Background()
+	q.Send("job", 0)
+
+	// 可见性超时后重新投递，旧的回执失效
+	d1, _ := q.Receive(ctx, 20*time.Millisecond)
+	start := time.Now()
+	d2, _ := q.Receive(ctx, 20*time.Millisecond)
+	if el := time.Since(start); el < 20*time.Millisecond || d2.ReceiveCount != 2 {
+		t.Fatal("message redelivered after ", el, " count ", d2.ReceiveCount)
+	}
+	if d1.Ack() != ErrInvalidReceipt {
+		t.Fatal("expired receipt must be invalid")
+	}
+
+	start = time.Now()
+	d2.Nack(20 * time.Millisecond)
+	d3, _ := q.Receive(ctx, time.Minute)
+	if el := time.Since(start); el < 20*time.Millisecond || d3.ReceiveCount != 3 {
+		t.Fatal("nacked message redelivered after ", el, " count ", d3.ReceiveCount)
+	}
+
+	d3.Nack(0)
+	dctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	dead, err := dlq.Receive(dctx, 0)
+	if err != nil || dead.Body != "job" {
+		t.Fatal("message must be dead-lettered after max receives, got ", err)
+	}
+	if delayed, ready, inFlight := q.Stats(); delayed+ready+inFlight != 0 {
+		t.Fatal("dead-lettered message must leave the queue")
+	}
+}
+
+func TestQueue_BlockingReceive(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	q := New(tw, Config{})
+	results := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			d, err := q.Receive(context.Background(), 0)
+			if err != nil {
+				results <- err
+				return
+			}
+			results <- d.Body
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	q.Send("a", 10*time.Millisecond)
+	if r := <-results; r != "a" {
+		t.Fatal("blocked receiver must get the message, got ", r)
+	}
+
+	q.Close()
+	if r := <-results; r != ErrClosed {
+		t.Fatal("close must release blocked receivers, got ", r)
+	}
+	if _, err := q.Send("b", 0); err != ErrClosed {
+		t.Fatal("expect ErrClosed, got ", err)
+	}
+}
@@ -0,0 +1,197 @@
+// Package lease manages named leases whose expiry is driven by a timing
+// wheel.
+package lease
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+var (
+	// ErrHeld is returned by Acquire when another owner holds the lease.
+	ErrHeld = errors.New("lease: held by another owner")
+	// ErrExpired is returned by the methods of a lease that expired.
+	ErrExpired = errors.New("lease: expired")
+	// ErrReleased is returned by the methods of a lease that was released.
+	ErrReleased = errors.New("lease: released")
+)
+
+// Config configures a Manager.
+type Config struct {
+	// Grace keeps a lease that was not renewed within its TTL for this much
+	// longer before it finally expires. During the grace period the owner can
+	// still renew the lease and no other owner can acquire it.
+	Grace time.Duration
+	// OnGrace is called when a lease enters its grace period.
+	OnGrace func(l *Lease)
+	// OnExpire is called when a lease finally expires.
+	OnExpire func(l *Lease)
+}
+
+// Manager hands out leases. Every lease keeps one wheel timer that is moved on
+// renewal, and expiry is decided under the lock of the manager, so a renewal
+// racing with the timer either wins or observes ErrExpired.
+type Manager struct {
+	timing timing.Timing
+	cfg    Config
+
+	mu     sync.Mutex
+	leases map[string]*Lease
+}
+
+func NewManager(tw timing.Timing, cfg Config) *Manager {
+	return &Manager{timing: tw, cfg: cfg, leases: make(map[string]*Lease)}
+}
+
+// Lease is a named lease held by an owner.
+type Lease struct {
+	m     *Manager
+	name  string
+	owner string
+	ttl   time.Duration
+	done  chan struct{}
+	timer timing.Timer
+
+	// 以下字段由m.mu保护
+	deadline time.Time // TTL到期时刻，不含宽限期
+	grace    bool
+	err      error
+}
+
+// Acquire takes the lease name for owner for ttl. If owner already holds it,
+// the lease is renewed with ttl and returned.
+func (m *Manager) Acquire(name, owner string, ttl time.Duration) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, ok := m.leases[name]; ok {
+		if l.owner != owner {
+			return nil, ErrHeld
+		}
+		l.ttl = ttl
+		l.renewLocked()
+		return l, nil
+	}
+
+	l := &Lease{
+		m:        m,
+		name:     name,
+		owner:    owner,
+		ttl:      ttl,
+		done:     make(chan struct{}),
+		deadline: time.Now().Add(ttl),
+	}
+	m.leases[name] = l
+	l.timer = m.timing.AddTask(ttl, l.fire)
+	return l, nil
+}
+
+// Holder returns the owner of the lease name.
+func (m *Manager) Holder(name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.leases[name]
+	if !ok {
+		return "", false
+	}
+	return l.owner, true
+}
+
+func (l *Lease) Name() string {
+	return l.name
+}
+
+func (l *Lease) Owner() string {
+	return l.owner
+}
+
+// Deadline returns the end of the current TTL, not counting the grace period.
+func (l *Lease) Deadline() time.Time {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	return l.deadline
+}
+
+// Done is closed once the lease has expired or been released.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns nil while the lease is held, then ErrExpired or ErrReleased.
+func (l *Lease) Err() error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	return l.err
+}
+
+// Renew restarts the TTL of the lease, also during its grace period.
+func (l *Lease) Renew() error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	l.renewLocked()
+	return nil
+}
+
+// Release gives the lease up and stops its timer.
+func (l *Lease) Release() error {
+	l.m.mu.Lock()
+	if l.err != nil {
+		l.m.mu.Unlock()
+		return l.err
+	}
+	l.endLocked(ErrReleased)
+	l.m.mu.Unlock()
+
+	l.timer.Stop()
+	return nil
+}
+
+func (l *Lease) renewLocked() {
+	l.deadline = time.Now().Add(l.ttl)
+	l.grace = false
+	l.timer.Reset(l.ttl)
+}
+
+func (l *Lease) endLocked(err error) {
+	l.err = err
+	delete(l.m.leases, l.name)
+	close(l.done)
+}
+
+func (l *Lease) fire() {
+	m := l.m
+	m.mu.Lock()
+	now := time.Now()
+	if l.err != nil || now.Before(l.deadline) {
+		// 已释放，或在timer触发期间被续约，timer已重新计时
+		m.mu.Unlock()
+		return
+	}
+
+	if !l.grace && m.cfg.Grace > 0 {
+		l.grace = true
+		l.timer.ResetAt(l.deadline.Add(m.cfg.Grace))
+		m.mu.Unlock()
+		if m.cfg.OnGrace != nil {
+			m.cfg.OnGrace(l)
+		}
+		return
+	}
+
+	if l.grace && now.Before(l.deadline.Add(m.cfg.Grace)) {
+		m.mu.Unlock()
+		return
+	}
+	l.endLocked(ErrExpired)
+	m.mu.Unlock()
+
+	if m.cfg.OnExpire != nil {
+		m.cfg.OnExpire(l)
+	}
+}
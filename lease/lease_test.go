@@ -0,0 +1,108 @@
+package lease
+
+import (
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+func TestManager_Expire(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	expired := make(chan *Lease, 1)
+	m := NewManager(tw, Config{OnExpire: func(l *Lease) { expired <- l }})
+
+	l, err := m.Acquire("job", "a", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Acquire("job", "b", time.Second); err != ErrHeld {
+		t.Fatal("expect ErrHeld, got ", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(15 * time.Millisecond)
+		if err := l.Renew(); err != nil {
+			t.Fatal("renew failed ", err)
+		}
+	}
+
+	start := time.Now()
+	select {
+	case <-l.Done():
+		if d := time.Since(start); d < 25*time.Millisecond {
+			t.Fatal("lease expired early ", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lease did not expire")
+	}
+	if got := <-expired; got != l {
+		t.Fatal("OnExpire must receive the lease")
+	}
+	if l.Err() != ErrExpired || l.Renew() != ErrExpired {
+		t.Fatal("expired lease must report ErrExpired")
+	}
+	if _, ok := m.Holder("job"); ok {
+		t.Fatal("expired lease must be free")
+	}
+	if _, err := m.Acquire("job", "b", time.Second); err != nil {
+		t.Fatal("expired lease must be acquirable, got ", err)
+	}
+}
+
+func TestManager_Grace(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	graced := make(chan *Lease, 2)
+	m := NewManager(tw, Config{Grace: 40 * time.Millisecond, OnGrace: func(l *Lease) { graced <- l }})
+
+	l, _ := m.Acquire("lock", "a", 20*time.Millisecond)
+	<-graced
+	if _, err := m.Acquire("lock", "b", time.Second); err != ErrHeld {
+		t.Fatal("lease in grace must stay held, got ", err)
+	}
+	if err := l.Renew(); err != nil {
+		t.Fatal("lease in grace must be renewable, got ", err)
+	}
+
+	<-graced
+	start := time.Now()
+	<-l.Done()
+	if d := time.Since(start); d < 35*time.Millisecond {
+		t.Fatal("grace period cut short ", d)
+	}
+	if l.Err() != ErrExpired {
+		t.Fatal("expect ErrExpired, got ", l.Err())
+	}
+}
+
+func TestLease_Release(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	m := NewManager(tw, Config{OnExpire: func(l *Lease) {
+		t.Error("released lease must not expire")
+	}})
+	l, _ := m.Acquire("job", "a", 20*time.Millisecond)
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if l.Release() != ErrReleased || l.Err() != ErrReleased {
+		t.Fatal("released lease must report ErrReleased")
+	}
+	if l.timer.State() != timing.TimerStopped {
+		t.Fatal("release must stop the timer, got ", l.timer.State())
+	}
+	<-l.Done()
+	if _, err := m.Acquire("job", "b", time.Second); err != nil {
+		t.Fatal("released lease must be acquirable, got ", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+}
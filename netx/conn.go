@@ -0,0 +1,229 @@
+// Package netx wraps net.Conn and net.Listener with idle, read and write
+// timeouts driven by one wheel timer per connection.
+package netx
+
+import (
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+var (
+	_start = time.Now()
+
+	// aLongTimeAgo is a deadline in the past that interrupts blocked I/O.
+	aLongTimeAgo = time.Unix(1, 0)
+)
+
+// now returns monotonic nanoseconds, cheaper to store than a time.Time.
+func now() int64 {
+	return int64(time.Since(_start))
+}
+
+type timeoutError struct {
+	msg string
+}
+
+func (e *timeoutError) Error() string   { return e.msg }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// ErrIdleTimeout is returned by Read and Write once the connection has been
+// closed for inactivity.
+var ErrIdleTimeout net.Error = &timeoutError{msg: "netx: idle timeout"}
+
+// Config holds the timeouts of a connection; zero disables a timeout.
+type Config struct {
+	// IdleTimeout closes the connection when no byte has been read or written
+	// for this long.
+	IdleTimeout time.Duration
+	// ReadTimeout interrupts a Read blocked for longer than this. The Read
+	// returns a timeout error and the connection stays usable.
+	ReadTimeout time.Duration
+	// WriteTimeout interrupts a Write blocked for longer than this.
+	WriteTimeout time.Duration
+}
+
+// Conn enforces the timeouts of Config without touching the deadlines of the
+// underlying connection on every call; it only sets a deadline in the past to
+// interrupt an expired Read or Write. Callers must not set read or write
+// deadlines themselves while the matching timeout is enabled.
+type Conn struct {
+	net.Conn
+	timing timing.Timing
+	cfg    Config
+
+	lastActive int64
+	readStart  int64
+	writeStart int64
+	idleClosed int32
+
+	mu               sync.Mutex
+	timer            timing.Timer
+	armed            int64 // timer的到期时刻
+	readInterrupted  bool
+	writeInterrupted bool
+	closed           bool
+}
+
+// Wrap returns c with the timeouts of cfg enforced on tw.
+func Wrap(c net.Conn, tw timing.Timing, cfg Config) *Conn {
+	conn := &Conn{
+		Conn:       c,
+		timing:     tw,
+		cfg:        cfg,
+		lastActive: now(),
+		armed:      math.MaxInt64,
+	}
+	if cfg.IdleTimeout > 0 {
+		conn.mu.Lock()
+		conn.arm(conn.lastActive+int64(cfg.IdleTimeout), conn.lastActive)
+		conn.mu.Unlock()
+	}
+	return conn
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if c.cfg.ReadTimeout > 0 {
+		c.mu.Lock()
+		if c.readInterrupted {
+			c.readInterrupted = false
+			c.Conn.SetReadDeadline(time.Time{})
+		}
+		start := now()
+		atomic.StoreInt64(&c.readStart, start)
+		c.arm(start+int64(c.cfg.ReadTimeout), start)
+		c.mu.Unlock()
+	}
+
+	n, err := c.Conn.Read(b)
+	if c.cfg.ReadTimeout > 0 {
+		atomic.StoreInt64(&c.readStart, 0)
+	}
+	return n, c.done(n, err)
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	if c.cfg.WriteTimeout > 0 {
+		c.mu.Lock()
+		if c.writeInterrupted {
+			c.writeInterrupted = false
+			c.Conn.SetWriteDeadline(time.Time{})
+		}
+		start := now()
+		atomic.StoreInt64(&c.writeStart, start)
+		c.arm(start+int64(c.cfg.WriteTimeout), start)
+		c.mu.Unlock()
+	}
+
+	n, err := c.Conn.Write(b)
+	if c.cfg.WriteTimeout > 0 {
+		atomic.StoreInt64(&c.writeStart, 0)
+	}
+	return n, c.done(n, err)
+}
+
+func (c *Conn) done(n int, err error) error {
+	if n > 0 {
+		atomic.StoreInt64(&c.lastActive, now())
+	}
+	if err != nil && atomic.LoadInt32(&c.idleClosed) == 1 {
+		return ErrIdleTimeout
+	}
+	return err
+}
+
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// arm makes sure the timer fires no later than deadline. It must be called
+// with c.mu held.
+func (c *Conn) arm(deadline, n int64) {
+	if c.closed || c.armed <= deadline {
+		return
+	}
+	c.armed = deadline
+	if c.timer == nil {
+		c.timer = c.timing.AddTask(time.Duration(deadline-n), c.check)
+		return
+	}
+	c.timer.Reset(time.Duration(deadline - n))
+}
+
+// check runs when the timer fires, enforces the expired timeouts and re-arms
+// the timer for the next one.
+func (c *Conn) check() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+
+	n := now()
+	next := int64(math.MaxInt64)
+
+	if c.cfg.IdleTimeout > 0 {
+		deadline := atomic.LoadInt64(&c.lastActive) + int64(c.cfg.IdleTimeout)
+		if deadline <= n {
+			atomic.StoreInt32(&c.idleClosed, 1)
+			c.closed = true
+			c.Conn.Close()
+			return
+		}
+		next = deadline
+	}
+
+	if start := atomic.LoadInt64(&c.readStart); start != 0 {
+		if deadline := start + int64(c.cfg.ReadTimeout); deadline <= n {
+			c.readInterrupted = true
+			c.Conn.SetReadDeadline(aLongTimeAgo)
+		} else if deadline < next {
+			next = deadline
+		}
+	}
+
+	if start := atomic.LoadInt64(&c.writeStart); start != 0 {
+		if deadline := start + int64(c.cfg.WriteTimeout); deadline <= n {
+			c.writeInterrupted = true
+			c.Conn.SetWriteDeadline(aLongTimeAgo)
+		} else if deadline < next {
+			next = deadline
+		}
+	}
+
+	c.armed = math.MaxInt64
+	if next != math.MaxInt64 {
+		c.arm(next, n)
+	}
+}
+
+type listener struct {
+	net.Listener
+	timing timing.Timing
+	cfg    Config
+}
+
+// WrapListener returns a listener whose accepted connections are wrapped with
+// Wrap.
+func WrapListener(l net.Listener, tw timing.Timing, cfg Config) net.Listener {
+	return &listener{Listener: l, timing: tw, cfg: cfg}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(c, l.timing, l.cfg), nil
+}
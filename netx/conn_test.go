@@ -0,0 +1,127 @@
+package netx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+func TestConn_ReadTimeout(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	c := Wrap(client, tw, Config{ReadTimeout: 30 * time.Millisecond})
+	defer c.Close()
+
+	start := time.Now()
+	buf := make([]byte, 4)
+	_, err := c.Read(buf)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatal("expect timeout error, got ", err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond || d > 100*time.Millisecond {
+		t.Fatal("read interrupted after ", d)
+	}
+
+	// 超时后连接仍然可用
+	go server.Write([]byte("ping"))
+	if n, err := c.Read(buf); err != nil || string(buf[:n]) != "ping" {
+		t.Fatal("read after timeout failed ", err)
+	}
+}
+
+func TestConn_WriteTimeout(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	c := Wrap(client, tw, Config{WriteTimeout: 30 * time.Millisecond})
+	defer c.Close()
+
+	_, err := c.Write([]byte("ping"))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatal("expect timeout error, got ", err)
+	}
+
+	go func() {
+		buf := make([]byte, 4)
+		server.Read(buf)
+	}()
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal("write after timeout failed ", err)
+	}
+}
+
+func TestConn_IdleTimeout(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	c := Wrap(client, tw, Config{IdleTimeout: 50 * time.Millisecond})
+
+	// 持续活动的连接不会被关闭
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(20 * time.Millisecond)
+			server.Write([]byte("x"))
+		}
+	}()
+	buf := make([]byte, 1)
+	for i := 0; i < 5; i++ {
+		if _, err := c.Read(buf); err != nil {
+			t.Fatal("active conn closed ", err)
+		}
+	}
+
+	start := time.Now()
+	if _, err := c.Read(buf); err != ErrIdleTimeout {
+		t.Fatal("expect idle timeout, got ", err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatal("idle conn closed after ", d)
+	}
+}
+
+func TestListener(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("loopback unavailable: ", err)
+	}
+	l = WrapListener(l, tw, Config{IdleTimeout: 30 * time.Millisecond})
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Read(make([]byte, 1))
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expect the idle conn to be closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("idle conn was not closed by the server")
+	}
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+	"github.com/welllog/timewheel/ttlcache"
+)
+
+// Keyed keeps one limiter per key and drops the limiters of keys that have
+// not been used for the idle period. idle should exceed the longest wait on a
+// limiter, or a key could get a fresh limiter while callers still wait on the
+// old one.
+type Keyed struct {
+	cache      *ttlcache.Cache
+	newLimiter func(key interface{}) Limiter
+	mu         sync.Mutex
+}
+
+func NewKeyed(tw timing.Timing, idle time.Duration, newLimiter func(key interface{}) Limiter) *Keyed {
+	return &Keyed{cache: ttlcache.New(tw, ttlcache.Config{TTL: idle}), newLimiter: newLimiter}
+}
+
+func (k *Keyed) Allow(key interface{}) bool {
+	return k.get(key).Allow()
+}
+
+func (k *Keyed) Reserve(key interface{}) *Reservation {
+	return k.get(key).Reserve()
+}
+
+func (k *Keyed) Wait(ctx context.Context, key interface{}) error {
+	return k.get(key).Wait(ctx)
+}
+
+// Len returns the number of keys with a limiter.
+func (k *Keyed) Len() int {
+	return k.cache.Len()
+}
+
+func (k *Keyed) get(key interface{}) Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if v, ok := k.cache.Get(key); ok && k.cache.Touch(key) {
+		return v.(Limiter)
+	}
+	l := k.newLimiter(key)
+	k.cache.Set(key, l)
+	return l
+}
@@ -0,0 +1,246 @@
+// Package ratelimit provides token-bucket and leaky-bucket rate limiters whose
+// waiting callers are queued and released by a timing wheel.
+//
+// Both limiters track the theoretical arrival time of the next request
+// instead of a token count, so an idle limiter holds no timer at all; a
+// limiter keeps one wheel timer, armed for the head of its queue, only while
+// callers are waiting in Wait.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+var (
+	// ErrLimitExceeded is returned when a leaky bucket's queue is full.
+	ErrLimitExceeded = errors.New("ratelimit: limit exceeded")
+	// ErrDeadline is returned by Wait when the turn of the caller would come
+	// after the deadline of its context.
+	ErrDeadline = errors.New("ratelimit: wait would exceed the context deadline")
+)
+
+type Limiter interface {
+	// Allow reports whether a request may happen now, taking its slot if so.
+	Allow() bool
+	// Reserve takes the next slot and tells when it may be used.
+	Reserve() *Reservation
+	// Wait blocks until the next slot, in the order of the calls.
+	Wait(ctx context.Context) error
+}
+
+type waiter struct {
+	ready    time.Time
+	c        chan struct{}
+	released bool
+}
+
+type limiter struct {
+	timing    timing.Timing
+	interval  time.Duration
+	tolerance time.Duration // 允许提前的时长, (burst-1)*interval
+	maxDelay  time.Duration // 小于0表示不限制
+
+	mu      sync.Mutex
+	tat     time.Time // 下一个请求的理论到达时刻
+	waiters []*waiter
+	timer   timing.Timer
+}
+
+// TokenBucket allows bursts of up to burst requests and one request every
+// interval on average.
+type TokenBucket struct {
+	limiter
+}
+
+// NewTokenBucket returns a full token bucket refilled with one token every
+// interval.
+func NewTokenBucket(tw timing.Timing, interval time.Duration, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{limiter{
+		timing:    tw,
+		interval:  interval,
+		tolerance: time.Duration(burst-1) * interval,
+		maxDelay:  -1,
+	}}
+}
+
+// LeakyBucket lets requests through at a constant rate of one every interval,
+// without bursts. Up to capacity requests may be queued; beyond that Reserve
+// and Wait fail with ErrLimitExceeded.
+type LeakyBucket struct {
+	limiter
+}
+
+func NewLeakyBucket(tw timing.Timing, interval time.Duration, capacity int) *LeakyBucket {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &LeakyBucket{limiter{
+		timing:   tw,
+		interval: interval,
+		maxDelay: time.Duration(capacity) * interval,
+	}}
+}
+
+func (l *limiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _, ok := l.reserveLocked(time.Now(), 0)
+	return ok
+}
+
+func (l *limiter) Reserve() *Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ready, tat, ok := l.reserveLocked(time.Now(), l.maxDelay)
+	return &Reservation{l: l, ok: ok, ready: ready, tat: tat}
+}
+
+func (l *limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	maxDelay := l.maxDelay
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		if d := deadline.Sub(now); maxDelay < 0 || d < maxDelay {
+			maxDelay = d
+		}
+	}
+	ready, tat, ok := l.reserveLocked(now, maxDelay)
+	if !ok {
+		l.mu.Unlock()
+		if hasDeadline && maxDelay != l.maxDelay {
+			return ErrDeadline
+		}
+		return ErrLimitExceeded
+	}
+	if !ready.After(now) {
+		l.mu.Unlock()
+		return nil
+	}
+
+	w := &waiter{ready: ready, c: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	if len(l.waiters) == 1 {
+		l.armLocked(ready)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-w.c:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.released {
+		return nil
+	}
+	for i, o := range l.waiters {
+		if o == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			break
+		}
+	}
+	l.cancelLocked(tat)
+	return ctx.Err()
+}
+
+// reserveLocked takes the next slot if it comes within maxDelay of now and
+// returns when it may be used and the arrival time it left behind.
+func (l *limiter) reserveLocked(now time.Time, maxDelay time.Duration) (time.Time, time.Time, bool) {
+	start := l.tat
+	if start.Before(now) {
+		start = now
+	}
+	ready := start.Add(-l.tolerance)
+	if ready.Before(now) {
+		ready = now
+	}
+	if maxDelay >= 0 && ready.Sub(now) > maxDelay {
+		return time.Time{}, time.Time{}, false
+	}
+	l.tat = start.Add(l.interval)
+	return ready, l.tat, true
+}
+
+// cancelLocked gives a slot back if no later slot has been taken since.
+func (l *limiter) cancelLocked(tat time.Time) {
+	if l.tat.Equal(tat) {
+		l.tat = tat.Add(-l.interval)
+	}
+}
+
+func (l *limiter) armLocked(at time.Time) {
+	if l.timer == nil {
+		l.timer = l.timing.AddTaskAt(at, l.release)
+		return
+	}
+	l.timer.ResetAt(at)
+}
+
+// release wakes the waiters whose turn has come, in order, and re-arms the
+// timer for the next one.
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	i := 0
+	for ; i < len(l.waiters) && !l.waiters[i].ready.After(now); i++ {
+		l.waiters[i].released = true
+		close(l.waiters[i].c)
+		l.waiters[i] = nil
+	}
+	l.waiters = l.waiters[i:]
+	if len(l.waiters) > 0 {
+		l.armLocked(l.waiters[0].ready)
+	}
+}
+
+// Reservation is a slot taken by Reserve.
+type Reservation struct {
+	l     *limiter
+	ok    bool
+	ready time.Time
+	tat   time.Time
+}
+
+// OK reports whether a slot was taken; it is false when a leaky bucket's
+// queue is full.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long to wait before using the slot.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+	if d := time.Until(r.ready); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Cancel gives the slot back if no later slot has been taken since.
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	r.l.mu.Lock()
+	r.l.cancelLocked(r.tat)
+	r.l.mu.Unlock()
+}
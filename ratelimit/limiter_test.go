@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	l := NewTokenBucket(tw, 20*time.Millisecond, 3)
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatal("burst must be allowed")
+		}
+	}
+	if l.Allow() {
+		t.Fatal("empty bucket must deny")
+	}
+
+	r := l.Reserve()
+	if d := r.Delay(); !r.OK() || d <= 0 || d > 20*time.Millisecond {
+		t.Fatal("unexpected delay ", d)
+	}
+	r.Cancel()
+
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 15*time.Millisecond || d > 60*time.Millisecond {
+		t.Fatal("canceled slot must be reused, waited ", d)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatal("bucket must refill up to burst")
+		}
+	}
+	if l.Allow() {
+		t.Fatal("bucket must not exceed burst")
+	}
+}
+
+func TestTokenBucket_WaitOrder(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	l := NewTokenBucket(tw, 5*time.Millisecond, 1)
+	l.Allow()
+
+	tat := func() time.Time {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.tat
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		prev := tat()
+		go func(i int) {
+			defer wg.Done()
+			if err := l.Wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		}(i)
+		// 等待该调用者取得位置后再启动下一个
+		for tat().Equal(prev) {
+			time.Sleep(50 * time.Microsecond)
+		}
+	}
+	wg.Wait()
+
+	for i, v := range order {
+		if v != i {
+			t.Fatal("waiters must be released in order, got ", order)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer == nil || len(l.waiters) != 0 {
+		t.Fatal("waiters must be released by the wheel timer")
+	}
+}
+
+func TestLimiter_WaitContext(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	l := NewTokenBucket(tw, 50*time.Millisecond, 1)
+	l.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != ErrDeadline {
+		t.Fatal("expect ErrDeadline, got ", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Fatal("expect Canceled, got ", err)
+	}
+	if r := l.Reserve(); r.Delay() > 50*time.Millisecond {
+		t.Fatal("canceled wait must give its slot back, delay ", r.Delay())
+	}
+}
+
+func TestLeakyBucket(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	l := NewLeakyBucket(tw, 10*time.Millisecond, 2)
+	if !l.Allow() || l.Allow() {
+		t.Fatal("leaky bucket must not burst")
+	}
+	if !l.Reserve().OK() || !l.Reserve().OK() {
+		t.Fatal("requests must be queued up to capacity")
+	}
+	if l.Reserve().OK() {
+		t.Fatal("full queue must reject")
+	}
+	if err := l.Wait(context.Background()); err != ErrLimitExceeded {
+		t.Fatal("expect ErrLimitExceeded, got ", err)
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	k := NewKeyed(tw, 30*time.Millisecond, func(key interface{}) Limiter {
+		return NewTokenBucket(tw, time.Hour, 1)
+	})
+	if !k.Allow("a") || k.Allow("a") || !k.Allow("b") {
+		t.Fatal("keys must have their own limiters")
+	}
+	if k.Len() != 2 {
+		t.Fatal("expect 2 keys, got ", k.Len())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if k.Len() != 0 {
+		t.Fatal("idle keys must expire, left ", k.Len())
+	}
+	if !k.Allow("a") {
+		t.Fatal("expired key must get a fresh limiter")
+	}
+}
@@ -0,0 +1,260 @@
+// Package retry reruns failing tasks on a timing wheel with exponential
+// backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+const (
+	defaultInitialInterval = 100 * time.Millisecond
+	defaultMaxInterval     = 30 * time.Second
+	defaultMultiplier      = 2
+)
+
+var ErrCanceled = errors.New("retry: job canceled")
+
+// Policy describes the backoff between attempts. Zero MaxAttempts and zero
+// MaxElapsed mean no limit.
+type Policy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// Jitter randomizes every interval by ±Jitter of its length, in [0, 1].
+	Jitter      float64
+	MaxAttempts int
+	MaxElapsed  time.Duration
+}
+
+// Backoff returns the delay after the given failed attempt, counted from 1.
+func (p Policy) Backoff(attempt int) time.Duration {
+	initial, max, mult := p.InitialInterval, p.MaxInterval, p.Multiplier
+	if initial <= 0 {
+		initial = defaultInitialInterval
+	}
+	if max <= 0 {
+		max = defaultMaxInterval
+	}
+	if mult < 1 {
+		mult = defaultMultiplier
+	}
+
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= mult
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+
+	if p.Jitter > 0 {
+		j := p.Jitter
+		if j > 1 {
+			j = 1
+		}
+		d += d * j * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// Failure is handed to the dead-letter callback once a job gives up.
+type Failure struct {
+	Err      error
+	Attempts int
+	Elapsed  time.Duration
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so that the job gives up without further attempts.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type Retrier struct {
+	timing     timing.Timing
+	policy     Policy
+	deadLetter func(Failure)
+}
+
+// New returns a Retrier whose attempts are scheduled on tw. deadLetter, if
+// not nil, receives every job that exhausts its attempts or elapsed time.
+func New(tw timing.Timing, policy Policy, deadLetter func(Failure)) *Retrier {
+	return &Retrier{timing: tw, policy: policy, deadLetter: deadLetter}
+}
+
+// Submit runs task immediately and retries it until it returns nil, the
+// policy gives up, it returns a Permanent error or ctx is done. A job whose
+// ctx is done while it waits for its next attempt finishes at once with
+// ctx.Err().
+func (r *Retrier) Submit(ctx context.Context, task func(ctx context.Context) error) *Job {
+	j := &Job{
+		r:     r,
+		ctx:   ctx,
+		task:  task,
+		start: time.Now(),
+		done:  make(chan struct{}),
+	}
+	j.mu.Lock()
+	j.timer = r.timing.AddTask(0, j.attempt)
+	j.stopWatch = context.AfterFunc(ctx, j.canceled)
+	j.mu.Unlock()
+	return j
+}
+
+type Job struct {
+	r         *Retrier
+	ctx       context.Context
+	task      func(ctx context.Context) error
+	start     time.Time
+	mu        sync.Mutex
+	timer     timing.Timer
+	stopWatch func() bool
+	attempts  int
+	running   bool // 正在执行task, 结束后自行检查ctx
+	err       error
+	finished  bool
+	done      chan struct{}
+}
+
+func (j *Job) attempt() {
+	if err := j.ctx.Err(); err != nil {
+		j.finish(err, false)
+		return
+	}
+
+	j.mu.Lock()
+	if j.finished {
+		j.mu.Unlock()
+		return
+	}
+	j.attempts++
+	attempts := j.attempts
+	j.running = true
+	j.mu.Unlock()
+
+	err := j.task(j.ctx)
+
+	j.mu.Lock()
+	j.running = false
+	j.mu.Unlock()
+	if err == nil {
+		j.finish(nil, false)
+		return
+	}
+
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		j.finish(perm.err, true)
+		return
+	}
+
+	p := j.r.policy
+	if p.MaxAttempts > 0 && attempts >= p.MaxAttempts {
+		j.finish(err, true)
+		return
+	}
+	delay := p.Backoff(attempts)
+	if p.MaxElapsed > 0 && time.Since(j.start)+delay > p.MaxElapsed {
+		j.finish(err, true)
+		return
+	}
+
+	if cerr := j.ctx.Err(); cerr != nil {
+		j.finish(cerr, false)
+		return
+	}
+
+	j.mu.Lock()
+	if !j.finished {
+		j.err = err
+		j.timer = j.r.timing.AddTask(delay, j.attempt)
+	}
+	j.mu.Unlock()
+}
+
+// canceled finishes the job when ctx is done while it waits for an attempt.
+func (j *Job) canceled() {
+	j.mu.Lock()
+	if j.finished || j.running {
+		j.mu.Unlock()
+		return
+	}
+	j.timer.Stop()
+	j.mu.Unlock()
+
+	j.finish(j.ctx.Err(), false)
+}
+
+func (j *Job) finish(err error, dead bool) {
+	j.mu.Lock()
+	if j.finished {
+		j.mu.Unlock()
+		return
+	}
+	j.finished = true
+	j.err = err
+	attempts := j.attempts
+	j.mu.Unlock()
+	j.stopWatch()
+
+	if dead && j.r.deadLetter != nil {
+		j.r.deadLetter(Failure{Err: err, Attempts: attempts, Elapsed: time.Since(j.start)})
+	}
+	close(j.done)
+}
+
+// Cancel stops any pending attempt. It reports whether the job was still
+// running.
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	if j.finished {
+		j.mu.Unlock()
+		return false
+	}
+	j.finished = true
+	j.err = ErrCanceled
+	j.timer.Stop()
+	j.mu.Unlock()
+	j.stopWatch()
+
+	close(j.done)
+	return true
+}
+
+// Done is closed once the job succeeded, gave up or was canceled.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Err returns the last error of the job, nil on success.
+func (j *Job) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+func (j *Job) Attempts() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.attempts
+}
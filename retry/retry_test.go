@@ -0,0 +1,144 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+var errTest = errors.New("test error")
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := Policy{InitialInterval: 10 * time.Millisecond, MaxInterval: 50 * time.Millisecond, Multiplier: 2}
+	expect := []time.Duration{10, 20, 40, 50, 50}
+	for i, e := range expect {
+		if d := p.Backoff(i + 1); d != e*time.Millisecond {
+			t.Fatal("attempt ", i+1, " expect ", e*time.Millisecond, " got ", d)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.Backoff(2); d < 10*time.Millisecond || d > 30*time.Millisecond {
+			t.Fatal("jitter out of range ", d)
+		}
+	}
+}
+
+func TestRetrier_Submit(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	dead := make(chan Failure, 1)
+	r := New(tw, Policy{InitialInterval: 5 * time.Millisecond, MaxAttempts: 3}, func(f Failure) {
+		dead <- f
+	})
+
+	var calls int
+	j := r.Submit(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTest
+		}
+		return nil
+	})
+	<-j.Done()
+	if j.Err() != nil || j.Attempts() != 3 {
+		t.Fatal("job must succeed on the third attempt, err ", j.Err(), " attempts ", j.Attempts())
+	}
+
+	j = r.Submit(context.Background(), func(ctx context.Context) error {
+		return errTest
+	})
+	<-j.Done()
+	select {
+	case f := <-dead:
+		if f.Err != errTest || f.Attempts != 3 {
+			t.Fatal("unexpected failure ", f)
+		}
+	default:
+		t.Fatal("exhausted job must go to the dead letter callback")
+	}
+
+	j = r.Submit(context.Background(), func(ctx context.Context) error {
+		return Permanent(errTest)
+	})
+	<-j.Done()
+	if j.Attempts() != 1 || j.Err() != errTest {
+		t.Fatal("permanent error must stop retrying")
+	}
+	<-dead
+}
+
+func TestRetrier_MaxElapsed(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	r := New(tw, Policy{InitialInterval: 20 * time.Millisecond, Multiplier: 1, MaxElapsed: 50 * time.Millisecond}, nil)
+	j := r.Submit(context.Background(), func(ctx context.Context) error {
+		return errTest
+	})
+	select {
+	case <-j.Done():
+		if j.Attempts() != 3 {
+			t.Fatal("expect 3 attempts within max elapsed, got ", j.Attempts())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job must give up after max elapsed")
+	}
+}
+
+func TestJob_Cancel(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	r := New(tw, Policy{InitialInterval: 50 * time.Millisecond}, nil)
+	j := r.Submit(context.Background(), func(ctx context.Context) error {
+		return errTest
+	})
+	time.Sleep(20 * time.Millisecond)
+	if !j.Cancel() {
+		t.Fatal("pending job must be canceled")
+	}
+	<-j.Done()
+	time.Sleep(60 * time.Millisecond)
+	if j.Attempts() != 1 || j.Err() != ErrCanceled {
+		t.Fatal("canceled job must not run again")
+	}
+}
+
+func TestRetrier_CancelContext(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	r := New(tw, Policy{InitialInterval: 2 * time.Second}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	j := r.Submit(ctx, func(ctx context.Context) error {
+		return errTest
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	cancel()
+	select {
+	case <-j.Done():
+		if d := time.Since(start); d > 50*time.Millisecond {
+			t.Fatal("job finished ", d, " after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job must finish when ctx is canceled during a backoff")
+	}
+	if j.Err() != context.Canceled || j.Attempts() != 1 {
+		t.Fatal("expect Canceled after 1 attempt, got ", j.Err(), j.Attempts())
+	}
+	if j.Cancel() {
+		t.Fatal("finished job must not be canceled again")
+	}
+}
@@ -0,0 +1,335 @@
+// Package schedule provides combinators for timing.Scheduler.
+//
+// A Scheduler that returns the zero time.Time tells ScheduleTask to stop, so
+// the wrappers below express their limits by returning the zero time. The
+// stateful wrappers implement timing.Peeker, so that a combinator or a
+// fixed-rate schedule probing them only uses up the runs that take place.
+package schedule
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+// maxIntersectSteps bounds the search for a common fire time in Intersect.
+const maxIntersectSteps = 1000
+
+type every struct {
+	d time.Duration
+}
+
+// Every fires every d after the previous call.
+func Every(d time.Duration) timing.Scheduler {
+	if d <= 0 {
+		panic("schedule: non-positive interval for Every")
+	}
+	return &every{d: d}
+}
+
+func (s *every) Next(now time.Time) time.Time {
+	return now.Add(s.d)
+}
+
+type limit struct {
+	s     timing.Scheduler
+	n     int64
+	count int64
+}
+
+// Limit stops s after n runs. Every call of Next counts as a run, Peek does
+// not.
+func Limit(s timing.Scheduler, n int) timing.Scheduler {
+	return &limit{s: s, n: int64(n)}
+}
+
+func (s *limit) Next(now time.Time) time.Time {
+	if atomic.AddInt64(&s.count, 1) > s.n {
+		return time.Time{}
+	}
+	return s.s.Next(now)
+}
+
+func (s *limit) Peek(now time.Time) time.Time {
+	if atomic.LoadInt64(&s.count) >= s.n {
+		return time.Time{}
+	}
+	return timing.Peek(s.s, now)
+}
+
+type until struct {
+	s   timing.Scheduler
+	end time.Time
+}
+
+// Until stops s once its next run would be after end.
+func Until(s timing.Scheduler, end time.Time) timing.Scheduler {
+	return &until{s: s, end: end}
+}
+
+func (s *until) Next(now time.Time) time.Time {
+	return s.cut(s.s.Next(now))
+}
+
+func (s *until) Peek(now time.Time) time.Time {
+	return s.cut(timing.Peek(s.s, now))
+}
+
+func (s *until) cut(next time.Time) time.Time {
+	if next.IsZero() || next.After(s.end) {
+		return time.Time{}
+	}
+	return next
+}
+
+type jitter struct {
+	s   timing.Scheduler
+	max int64
+
+	mu     sync.Mutex
+	base   time.Time
+	offset time.Duration
+}
+
+// Jitter delays every run of s by a random duration in [0, maxJitter).
+func Jitter(s timing.Scheduler, maxJitter time.Duration) timing.Scheduler {
+	return &jitter{s: s, max: int64(maxJitter)}
+}
+
+func (s *jitter) Next(now time.Time) time.Time {
+	return s.add(s.s.Next(now))
+}
+
+func (s *jitter) Peek(now time.Time) time.Time {
+	return s.add(timing.Peek(s.s, now))
+}
+
+// add keeps the delay drawn for a run of s, so that Peek and the following
+// Next agree.
+func (s *jitter) add(next time.Time) time.Time {
+	if next.IsZero() || s.max <= 0 {
+		return next
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !next.Equal(s.base) {
+		s.base = next
+		s.offset = time.Duration(rand.Int63n(s.max))
+	}
+	return next.Add(s.offset)
+}
+
+type startAt struct {
+	s     timing.Scheduler
+	start time.Time
+}
+
+// StartAt runs first at start, then follows s.
+func StartAt(s timing.Scheduler, start time.Time) timing.Scheduler {
+	return &startAt{s: s, start: start}
+}
+
+func (s *startAt) Next(now time.Time) time.Time {
+	if now.Before(s.start) {
+		return s.start
+	}
+	return s.s.Next(now)
+}
+
+func (s *startAt) Peek(now time.Time) time.Time {
+	if now.Before(s.start) {
+		return s.start
+	}
+	return timing.Peek(s.s, now)
+}
+
+type union struct {
+	ss []timing.Scheduler
+}
+
+// Union fires whenever any of ss fires and stops once all of them have stopped.
+// A run is only scheduled on the schedules that fire at that time.
+func Union(ss ...timing.Scheduler) timing.Scheduler {
+	return &union{ss: ss}
+}
+
+func (s *union) Next(now time.Time) time.Time {
+	next := s.Peek(now)
+	if next.IsZero() {
+		return next
+	}
+	for _, sc := range s.ss {
+		if p, ok := sc.(timing.Peeker); ok && p.Peek(now).Equal(next) {
+			sc.Next(now)
+		}
+	}
+	return next
+}
+
+func (s *union) Peek(now time.Time) time.Time {
+	var next time.Time
+	for _, sc := range s.ss {
+		n := timing.Peek(sc, now)
+		if n.IsZero() {
+			continue
+		}
+		if next.IsZero() || n.Before(next) {
+			next = n
+		}
+	}
+	return next
+}
+
+type intersect struct {
+	ss []timing.Scheduler
+}
+
+// Intersect fires only at times on which all of ss agree and stops as soon as
+// any of them stops. The schedules are probed with Peek, and a run is only
+// scheduled on them once they agree.
+func Intersect(ss ...timing.Scheduler) timing.Scheduler {
+	return &intersect{ss: ss}
+}
+
+func (s *intersect) Next(now time.Time) time.Time {
+	next, cur := s.find(now)
+	if next.IsZero() {
+		return next
+	}
+	for _, sc := range s.ss {
+		if _, ok := sc.(timing.Peeker); ok {
+			sc.Next(cur)
+		}
+	}
+	return next
+}
+
+func (s *intersect) Peek(now time.Time) time.Time {
+	next, _ := s.find(now)
+	return next
+}
+
+// find returns the first time after now on which all schedules agree, and the
+// time they were probed with to get it.
+func (s *intersect) find(now time.Time) (time.Time, time.Time) {
+	if len(s.ss) == 0 {
+		return time.Time{}, now
+	}
+
+	cur := now
+	for i := 0; i < maxIntersectSteps; i++ {
+		var max time.Time
+		agree := true
+		for j, sc := range s.ss {
+			n := timing.Peek(sc, cur)
+			if n.IsZero() {
+				return time.Time{}, cur
+			}
+			if j == 0 {
+				max = n
+				continue
+			}
+			if !n.Equal(max) {
+				agree = false
+				if n.After(max) {
+					max = n
+				}
+			}
+		}
+		if agree {
+			return max, cur
+		}
+		// 从最晚的候选时间之前重新探测，各调度器都会给出不早于该时间的下一次触发
+		cur = max.Add(-time.Nanosecond)
+	}
+	return time.Time{}, cur
+}
+
+type aligned struct {
+	period int64
+	offset int64
+	loc    *time.Location
+}
+
+// Align fires on the wall-clock boundaries of loc that are a multiple of
+// period plus offset, e.g. Align(15*time.Minute, 5*time.Minute, loc) fires at
+// :05, :20, :35 and :50. A nil loc means UTC.
+//
+// Across a daylight saving change, periods no longer than the change keep their
+// pace: boundaries in a skipped hour are left out and those in a repeated hour
+// fire on both passes. Longer periods fire once per boundary: a skipped one
+// fires when the clock jumps forward, a repeated one only on its first pass.
+func Align(period, offset time.Duration, loc *time.Location) timing.Scheduler {
+	if period <= 0 {
+		panic("schedule: non-positive period for Align")
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &aligned{period: int64(period), offset: floorMod(int64(offset), int64(period)), loc: loc}
+}
+
+func (s *aligned) Next(now time.Time) time.Time {
+	local := now.In(s.loc)
+	_, zone := local.Zone()
+	off := int64(zone) * int64(time.Second)
+	start, end := local.ZoneBounds()
+
+	at := now.UnixNano()
+	minWall := int64(math.MinInt64)
+	if !start.IsZero() {
+		// 处于回拨后重复的墙上时间内，长周期的边界已在第一遍触发过
+		_, prev := start.Add(-time.Nanosecond).In(s.loc).Zone()
+		if shift := off - int64(prev)*int64(time.Second); shift < 0 && s.period > -shift {
+			minWall = start.UnixNano() + off - shift
+		}
+	}
+
+	inclusive := false
+	for {
+		next := s.boundary(at+off, inclusive, minWall) - off
+		if end.IsZero() || next < end.UnixNano() {
+			return time.Unix(0, next).In(s.loc)
+		}
+
+		// 下一个边界落在时区切换之后，按切换后的偏移继续
+		at = end.UnixNano()
+		local = end.In(s.loc)
+		_, zone = local.Zone()
+		shift := int64(zone)*int64(time.Second) - off
+		if shift > 0 && s.period > shift && s.boundary(at+off, true, minWall) < at+off+shift {
+			// 边界所在的墙上时间被跳过，在时钟拨快时触发
+			return local
+		}
+		if shift < 0 && s.period > -shift {
+			minWall = at + off
+		}
+		off += shift
+		_, end = local.ZoneBounds()
+		inclusive = true
+	}
+}
+
+// boundary returns the first boundary of the wall clock after wall, or at wall
+// when inclusive, that is not before minWall.
+func (s *aligned) boundary(wall int64, inclusive bool, minWall int64) int64 {
+	if !inclusive {
+		wall++
+	}
+	if wall < minWall {
+		wall = minWall
+	}
+	return wall + floorMod(s.offset-wall, s.period)
+}
+
+func floorMod(x, m int64) int64 {
+	r := x % m
+	if r < 0 {
+		r += m
+	}
+	return r
+}
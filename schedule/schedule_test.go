@@ -0,0 +1,232 @@
+package schedule
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/welllog/timewheel/timing"
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+type multiple struct {
+	d time.Duration
+}
+
+func (s *multiple) Next(now time.Time) time.Time {
+	return now.Truncate(s.d).Add(s.d)
+}
+
+var _base = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestLimit(t *testing.T) {
+	s := Limit(Every(time.Second), 3)
+	now := _base
+	for i := 0; i < 3; i++ {
+		next := s.Next(now)
+		if !next.Equal(now.Add(time.Second)) {
+			t.Fatal("unexpected next ", next)
+		}
+		now = next
+	}
+	if !s.Next(now).IsZero() {
+		t.Fatal("limit must stop after 3 runs")
+	}
+
+	s = Limit(Every(time.Second), 1)
+	for i := 0; i < 3; i++ {
+		if timing.Peek(s, _base).IsZero() {
+			t.Fatal("peek must not use up runs")
+		}
+	}
+	if s.Next(_base).IsZero() || !timing.Peek(s, _base).IsZero() {
+		t.Fatal("limit must stop after 1 run")
+	}
+}
+
+func TestUntil(t *testing.T) {
+	s := Until(Every(time.Second), _base.Add(2*time.Second))
+	if s.Next(_base).IsZero() || s.Next(_base.Add(time.Second)).IsZero() {
+		t.Fatal("until stopped too early")
+	}
+	if !s.Next(_base.Add(1500 * time.Millisecond)).IsZero() {
+		t.Fatal("until must stop after end")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	s := Jitter(Every(time.Second), 100*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		now := _base.Add(time.Duration(i) * time.Hour)
+		peek := timing.Peek(s, now)
+		next := s.Next(now)
+		if d := next.Sub(now); d < time.Second || d >= 1100*time.Millisecond {
+			t.Fatal("jitter out of range ", d)
+		}
+		if !peek.Equal(next) {
+			t.Fatal("peek and next must agree")
+		}
+	}
+	if !Jitter(Limit(Every(time.Second), 0), time.Second).Next(_base).IsZero() {
+		t.Fatal("jitter must keep the stop signal")
+	}
+}
+
+func TestStartAt(t *testing.T) {
+	start := _base.Add(time.Hour)
+	s := StartAt(Every(time.Second), start)
+	if !s.Next(_base).Equal(start) {
+		t.Fatal("first run must be at start")
+	}
+	if !s.Next(start).Equal(start.Add(time.Second)) {
+		t.Fatal("runs after start must follow the schedule")
+	}
+}
+
+func TestUnion(t *testing.T) {
+	s := Union(&multiple{d: 2 * time.Second}, &multiple{d: 3 * time.Second})
+	expect := []int{2, 3, 4, 6, 8, 9, 10, 12}
+	now := _base
+	for _, sec := range expect {
+		now = s.Next(now)
+		if !now.Equal(_base.Add(time.Duration(sec) * time.Second)) {
+			t.Fatal("expect ", sec, " got ", now.Sub(_base))
+		}
+	}
+
+	if !Union(Limit(Every(time.Second), 0)).Next(_base).IsZero() {
+		t.Fatal("union of stopped schedules must stop")
+	}
+
+	// 未被选中的调度器不消耗运行次数
+	s = Union(Limit(Align(5*time.Second, 0, nil), 2), Align(3*time.Second, 0, nil))
+	expect = []int{3, 5, 6, 9, 10, 12, 15}
+	now = _base
+	for _, sec := range expect {
+		now = s.Next(now)
+		if !now.Equal(_base.Add(time.Duration(sec) * time.Second)) {
+			t.Fatal("expect ", sec, " got ", now.Sub(_base))
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	s := Intersect(&multiple{d: 2 * time.Second}, &multiple{d: 3 * time.Second})
+	now := _base
+	for i := 1; i <= 3; i++ {
+		now = s.Next(now)
+		if !now.Equal(_base.Add(time.Duration(i*6) * time.Second)) {
+			t.Fatal("expect ", i*6, " got ", now.Sub(_base))
+		}
+	}
+
+	s = Intersect(&multiple{d: 2 * time.Second}, Until(&multiple{d: 3 * time.Second}, _base.Add(5*time.Second)))
+	if !s.Next(_base).IsZero() {
+		t.Fatal("intersect must stop when a schedule stops")
+	}
+
+	s = Intersect(Limit(&multiple{d: 2 * time.Second}, 2), &multiple{d: 3 * time.Second})
+	now = _base
+	for i := 1; i <= 2; i++ {
+		now = s.Next(now)
+		if !now.Equal(_base.Add(time.Duration(i*6) * time.Second)) {
+			t.Fatal("expect ", i*6, " got ", now.Sub(_base))
+		}
+	}
+	if !s.Next(now).IsZero() {
+		t.Fatal("intersect must stop after the limited runs")
+	}
+}
+
+func TestScheduleTask(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	var runs int32
+	tw.ScheduleTask(Limit(Every(20*time.Millisecond), 3), func() {
+		atomic.AddInt32(&runs, 1)
+	})
+
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 3 {
+		t.Fatal("expect 3 runs, got ", n)
+	}
+}
+
+func TestAlign(t *testing.T) {
+	s := Align(15*time.Minute, 5*time.Minute, nil)
+	now := time.Date(2020, 1, 1, 10, 7, 30, 0, time.UTC)
+	expect := []int{20, 35, 50, 65}
+	for _, m := range expect {
+		now = s.Next(now)
+		if !now.Equal(time.Date(2020, 1, 1, 10, m, 0, 0, time.UTC)) {
+			t.Fatal("expect minute ", m, " got ", now)
+		}
+	}
+
+	loc := time.FixedZone("UTC+5:30", 5*3600+1800)
+	s = Align(time.Hour, 0, loc)
+	next := s.Next(time.Date(2020, 1, 1, 10, 7, 0, 0, loc))
+	if !next.Equal(time.Date(2020, 1, 1, 11, 0, 0, 0, loc)) {
+		t.Fatal("boundary must follow the location, got ", next)
+	}
+	if !s.Next(next).Equal(next.Add(time.Hour)) {
+		t.Fatal("a boundary must not be returned twice")
+	}
+}
+
+func TestAlign_DST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour, min int, day int, month time.Month) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		name   string
+		period time.Duration
+		offset time.Duration
+		now    time.Time
+		expect []time.Time
+	}{
+		// 2026-03-08 02:00 EST拨快到03:00 EDT
+		{"spring 15m", 15 * time.Minute, 5 * time.Minute, at(6, 50, 8, time.March),
+			[]time.Time{at(7, 5, 8, time.March), at(7, 20, 8, time.March)}},
+		{"spring 24h", 24 * time.Hour, 150 * time.Minute, at(7, 30, 7, time.March),
+			[]time.Time{at(7, 0, 8, time.March), at(6, 30, 9, time.March)}},
+		// 2026-11-01 02:00 EDT回拨到01:00 EST
+		{"fall 1m", time.Minute, 0, at(5, 59, 1, time.November),
+			[]time.Time{at(6, 0, 1, time.November), at(6, 1, 1, time.November)}},
+		{"fall 1h", time.Hour, 0, at(4, 30, 1, time.November),
+			[]time.Time{at(5, 0, 1, time.November), at(6, 0, 1, time.November), at(7, 0, 1, time.November)}},
+		{"fall 24h", 24 * time.Hour, 90 * time.Minute, at(4, 0, 1, time.November),
+			[]time.Time{at(5, 30, 1, time.November), at(6, 30, 2, time.November)}},
+		{"fall 24h repeated pass", 24 * time.Hour, 90 * time.Minute, at(6, 10, 1, time.November),
+			[]time.Time{at(6, 30, 2, time.November)}},
+	}
+	for _, c := range cases {
+		s := Align(c.period, c.offset, ny)
+		now := c.now
+		for _, e := range c.expect {
+			now = s.Next(now)
+			if !now.Equal(e) {
+				t.Fatal(c.name, " expect ", e.In(ny), " got ", now)
+			}
+		}
+	}
+
+	// 任意时刻给出的下一次触发都必须在其之后
+	for _, period := range []time.Duration{time.Minute, 15 * time.Minute, time.Hour, 90 * time.Minute, 24 * time.Hour} {
+		s := Align(period, 5*time.Minute, ny)
+		for _, day := range []time.Time{at(0, 0, 8, time.March), at(0, 0, 1, time.November)} {
+			for now := day; now.Before(day.Add(12 * time.Hour)); now = now.Add(7 * time.Minute) {
+				if next := s.Next(now); !next.After(now) || next.Sub(now) > period+time.Hour {
+					t.Fatal("period ", period, " from ", now.In(ny), " got ", next)
+				}
+			}
+		}
+	}
+}
@@ -1,14 +1,144 @@
 package timewheel
 
-import "github.com/welllog/timewheel/timing"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/welllog/timewheel/schedule"
+	"github.com/welllog/timewheel/timing"
+)
+
+type tickMode int
+
+const (
+	tickDrop tickMode = iota
+	tickCoalesce
+	tickBuffer
+)
+
+// TickPolicy decides what a ticker does with a tick the consumer is not
+// ready to receive. Ticks that do not make it to C are counted by
+// Ticker.Missed.
+type TickPolicy struct {
+	mode tickMode
+	size int
+}
+
+// DropTicks keeps the pending tick and drops new ones, like time.Ticker.
+func DropTicks() TickPolicy {
+	return TickPolicy{mode: tickDrop, size: 1}
+}
+
+// CoalesceTicks replaces the pending tick with the newest one.
+func CoalesceTicks() TickPolicy {
+	return TickPolicy{mode: tickCoalesce, size: 1}
+}
+
+// BufferTicks queues up to n ticks and drops new ones once the buffer is full.
+func BufferTicks(n int) TickPolicy {
+	return TickPolicy{mode: tickBuffer, size: n}
+}
+
+type tickSender struct {
+	c      chan time.Time
+	mode   tickMode
+	missed uint64
+}
+
+func newTickSender(p TickPolicy) *tickSender {
+	size := p.size
+	if size < 1 {
+		size = 1
+	}
+	return &tickSender{c: make(chan time.Time, size), mode: p.mode}
+}
+
+func (s *tickSender) send(now time.Time) {
+	select {
+	case s.c <- now:
+		return
+	default:
+	}
+
+	atomic.AddUint64(&s.missed, 1)
+	if s.mode == tickCoalesce {
+		select {
+		case <-s.c:
+		default:
+		}
+		select {
+		case s.c <- now:
+		default:
+		}
+	}
+}
 
 type Ticker struct {
-	C     <-chan struct{}
-	stop  chan struct{}
-	timer timing.Timer
+	C      <-chan time.Time
+	sender *tickSender
+	ticker interface {
+		Stop()
+		Reset(d time.Duration)
+	}
 }
 
 func (t *Ticker) Stop() {
-	close(t.stop)
+	t.ticker.Stop()
+}
+
+// Reset stops the ticker and changes its period to d. The next tick arrives
+// after d elapses.
+func (t *Ticker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.ticker.Reset(d)
+}
+
+// Missed returns the number of ticks dropped or coalesced since the last call.
+func (t *Ticker) Missed() uint64 {
+	return atomic.SwapUint64(&t.sender.missed, 0)
+}
+
+type wheelTicker struct {
+	s     *defscheduler
+	timer timing.Timer
+}
+
+func (t *wheelTicker) Stop() {
+	t.timer.Stop()
+}
+
+func (t *wheelTicker) Reset(d time.Duration) {
+	t.s.setDelay(d)
+	t.timer.Reset(d)
+}
+
+type alignedTicker struct {
+	mu     sync.Mutex
+	timing timing.Timing
+	offset time.Duration
+	loc    *time.Location
+	send   func()
+	timer  timing.Timer
+}
+
+func (t *alignedTicker) start(period time.Duration) {
+	t.timer = t.timing.ScheduleTask(schedule.Align(period, t.offset, t.loc), t.send,
+		timing.FixedRate(timing.MisfireSkip))
+}
+
+func (t *alignedTicker) Stop() {
+	t.mu.Lock()
+	t.timer.Stop()
+	t.mu.Unlock()
+}
+
+// Reset keeps the offset and location and aligns the ticks to the new period.
+func (t *alignedTicker) Reset(d time.Duration) {
+	t.mu.Lock()
 	t.timer.Stop()
+	t.start(d)
+	t.mu.Unlock()
 }
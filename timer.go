@@ -1,37 +1,37 @@
 package timewheel
 
-import (
-	"time"
-
-	"github.com/welllog/timewheel/timing"
-)
+import "time"
 
+// Timer mirrors time.Timer on top of the timing wheel. C is nil for timers
+// created by AfterFunc.
 type Timer struct {
-	C      <-chan struct{}
-	recv   chan<- struct{}
-	fn     func()
-	timing timing.Timing
-	timer  timing.Timer
+	C     <-chan time.Time
+	timer interface {
+		Stop() bool
+		Reset(d time.Duration) bool
+	}
 }
 
 func (t *Timer) Stop() bool {
 	return t.timer.Stop()
 }
 
-// 	if !t.Stop() {
-// 		<-t.C
-// 	}
-// 	t.Reset(d)
-func (t *Timer) Reset(d time.Duration) {
-	if t.fn != nil {
-		t.timer = t.timing.AddTask(d, func() {
-			t.fn()
-			t.recv <- struct{}{}
-		})
-		return
-	}
+// Reset moves the timer in place and reports whether it was active. As with
+// time.Timer, a timer that may have fired should be stopped and drained first:
+//
+//	if !t.Stop() {
+//		<-t.C
+//	}
+//	t.Reset(d)
+func (t *Timer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
 
-	t.timer = t.timing.AddTask(d, func() {
-		t.recv <- struct{}{}
-	})
+func sendTime(c chan time.Time) func() {
+	return func() {
+		select {
+		case c <- time.Now():
+		default:
+		}
+	}
 }
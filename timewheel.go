@@ -1,7 +1,8 @@
 package timewheel
 
 import (
-	"sync"
+	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/welllog/timewheel/timing"
@@ -11,11 +12,15 @@ import (
 type DRIVER string
 
 type defscheduler struct {
-	delay time.Duration
+	delay int64
 }
 
 func (s *defscheduler) Next(now time.Time) time.Time {
-	return now.Add(s.delay)
+	return now.Add(time.Duration(atomic.LoadInt64(&s.delay)))
+}
+
+func (s *defscheduler) setDelay(d time.Duration) {
+	atomic.StoreInt64(&s.delay, int64(d))
 }
 
 const (
@@ -34,59 +39,65 @@ func StopTiming() {
 }
 
 func NewTimer(d time.Duration) *Timer {
-	c := make(chan struct{}, 1)
-	t := Timing.AddTask(d, func() {
-		c <- struct{}{}
-	})
-	return &Timer{
-		C:      c,
-		recv:   c,
-		timing: Timing,
-		timer:  t,
-	}
+	return NewWheelClock(Timing).NewTimer(d)
 }
 
 func NewTicker(d time.Duration) *Ticker {
-	c := make(chan struct{})
-	stop := make(chan struct{})
-
-	t := Timing.ScheduleTask(&defscheduler{delay: d}, func() {
-		select {
-		case c <- struct{}{}:
-		case <-stop:
-		}
-	})
-	return &Ticker{
-		C:     c,
-		stop:  stop,
-		timer: t,
-	}
+	return NewWheelClock(Timing).NewTicker(d)
+}
+
+func NewTickerWithPolicy(d time.Duration, policy TickPolicy) *Ticker {
+	return NewWheelClock(Timing).NewTickerWithPolicy(d, policy)
+}
+
+func NewAlignedTicker(period, offset time.Duration, loc *time.Location) *Ticker {
+	return NewWheelClock(Timing).NewAlignedTicker(period, offset, loc)
+}
+
+func NewAlignedTimer(period, offset time.Duration, loc *time.Location) *Timer {
+	return NewWheelClock(Timing).NewAlignedTimer(period, offset, loc)
 }
 
 func Sleep(d time.Duration) {
-	w := &sync.WaitGroup{}
-	w.Add(1)
-	Timing.AddTask(d, func() { w.Done() })
-	w.Wait()
+	NewWheelClock(Timing).Sleep(d)
+}
+
+func SleepContext(ctx context.Context, d time.Duration) error {
+	return NewWheelClock(Timing).SleepContext(ctx, d)
+}
+
+func WaitUntil(ctx context.Context, t time.Time) error {
+	return NewWheelClock(Timing).WaitUntil(ctx, t)
+}
+
+func Timeout(ctx context.Context, d time.Duration, fn func(ctx context.Context) error) error {
+	return NewWheelClock(Timing).Timeout(ctx, d, fn)
+}
+
+func WithDeadline(parent context.Context, d time.Time) (context.Context, context.CancelFunc) {
+	return NewWheelClock(Timing).WithDeadline(parent, d)
+}
+
+func WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return NewWheelClock(Timing).WithTimeout(parent, timeout)
 }
 
 func After(d time.Duration) <-chan time.Time {
-	c := make(chan time.Time, 1)
-	Timing.AddTask(d, func() { c <- time.Now() })
-	return c
+	return NewWheelClock(Timing).After(d)
+}
+
+func TimerAt(t time.Time) *Timer {
+	return NewWheelClock(Timing).TimerAt(t)
+}
+
+func AfterAt(t time.Time) <-chan time.Time {
+	return NewWheelClock(Timing).AfterAt(t)
+}
+
+func AfterFuncAt(t time.Time, f func()) *Timer {
+	return NewWheelClock(Timing).AfterFuncAt(t, f)
 }
 
 func AfterFunc(d time.Duration, f func()) *Timer {
-	c := make(chan struct{}, 1)
-	t := Timing.AddTask(d, func() {
-		f()
-		c <- struct{}{}
-	})
-	return &Timer{
-		C:      c,
-		recv:   c,
-		fn:     f,
-		timing: Timing,
-		timer:  t,
-	}
+	return NewWheelClock(Timing).AfterFunc(d, f)
 }
@@ -1,6 +1,8 @@
 package timewheel
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -170,3 +172,195 @@ func TestTicker(t *testing.T) {
 	<-ticker.C
 	fmt.Println(time.Now().Sub(start).Seconds())
 }
+
+func TestTimer_Reset(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	start := time.Now()
+	timer := NewTimer(time.Second)
+	if !timer.Reset(200 * time.Millisecond) {
+		t.Error("reset of an active timer must return true")
+	}
+	select {
+	case end := <-timer.C:
+		checkTime(t, start, end, 195*time.Millisecond, 260*time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatal("delay run")
+	}
+
+	if timer.Reset(100 * time.Millisecond) {
+		t.Error("reset of an expired timer must return false")
+	}
+	<-timer.C
+
+	timer = AfterFunc(time.Second, func() {})
+	if timer.C != nil {
+		t.Error("AfterFunc timer must have a nil C")
+	}
+	if !timer.Stop() {
+		t.Error("stop of an active timer must return true")
+	}
+}
+
+func TestTicker_Reset(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	ticker := NewTicker(time.Second)
+	defer ticker.Stop()
+
+	start := time.Now()
+	ticker.Reset(100 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		end := <-ticker.C
+		checkTime(t, start, end, 95*time.Millisecond, 160*time.Millisecond)
+		start = end
+	}
+	ticker.Stop()
+	ticker.Stop()
+}
+
+func TestTicker_Policy(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+
+	drop := c.NewTickerWithPolicy(time.Second, DropTicks())
+	coalesce := c.NewTickerWithPolicy(time.Second, CoalesceTicks())
+	buffer := c.NewTickerWithPolicy(time.Second, BufferTicks(3))
+	c.Add(5 * time.Second)
+
+	if got := <-drop.C; !got.Equal(start.Add(time.Second)) || drop.Missed() != 4 {
+		t.Error("drop policy must keep the first tick, got ", got)
+	}
+	if got := <-coalesce.C; !got.Equal(start.Add(5*time.Second)) || coalesce.Missed() != 4 {
+		t.Error("coalesce policy must keep the newest tick, got ", got)
+	}
+	for i := 1; i <= 3; i++ {
+		if got := <-buffer.C; !got.Equal(start.Add(time.Duration(i) * time.Second)) {
+			t.Error("buffer policy must keep the first 3 ticks, got ", got)
+		}
+	}
+	if buffer.Missed() != 2 || buffer.Missed() != 0 {
+		t.Error("missed must count the ticks dropped since the last call")
+	}
+
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	ticker := NewTickerWithPolicy(20*time.Millisecond, CoalesceTicks())
+	defer ticker.Stop()
+	time.Sleep(110 * time.Millisecond)
+	<-ticker.C
+	if n := ticker.Missed(); n < 3 {
+		t.Error("slow consumer must see missed ticks, got ", n)
+	}
+}
+
+func TestAlignedTicker(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	period := 100 * time.Millisecond
+	ticker := NewAlignedTicker(period, 10*time.Millisecond, time.UTC)
+	defer ticker.Stop()
+	for i := 0; i < 5; i++ {
+		tick := <-ticker.C
+		if d := time.Duration(tick.UnixNano()%int64(period)) - 10*time.Millisecond; d < 0 || d > 5*time.Millisecond {
+			t.Error("tick is not aligned ", tick)
+		}
+	}
+
+	timer := NewAlignedTimer(period, 0, nil)
+	tick := <-timer.C
+	if d := time.Duration(tick.UnixNano() % int64(period)); d > 5*time.Millisecond {
+		t.Error("timer is not aligned ", tick)
+	}
+}
+
+func TestTimerAt(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	select {
+	case end := <-AfterAt(deadline):
+		if end.Before(deadline) {
+			t.Error("run ahead")
+		}
+	case <-time.After(220 * time.Millisecond):
+		t.Error("delay run")
+	}
+
+	timer := TimerAt(time.Now().Add(-time.Second))
+	select {
+	case <-timer.C:
+	case <-time.After(20 * time.Millisecond):
+		t.Error("past deadline must fire immediately")
+	}
+
+	ch := make(chan time.Time, 1)
+	deadline = time.Now().Add(50 * time.Millisecond)
+	AfterFuncAt(deadline, func() { ch <- time.Now() })
+	select {
+	case end := <-ch:
+		if end.Before(deadline) {
+			t.Error("run ahead")
+		}
+	case <-time.After(170 * time.Millisecond):
+		t.Error("delay run")
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	start := time.Now()
+	if err := SleepContext(context.Background(), 50*time.Millisecond); err != nil {
+		t.Error("unexpected error ", err)
+	}
+	checkTime(t, start, time.Now(), 45*time.Millisecond, 120*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	AfterFunc(20*time.Millisecond, cancel)
+	start = time.Now()
+	if err := SleepContext(ctx, time.Hour); err != context.Canceled {
+		t.Error("sleep must be interrupted, got ", err)
+	}
+	checkTime(t, start, time.Now(), 15*time.Millisecond, 100*time.Millisecond)
+
+	start = time.Now()
+	if err := WaitUntil(context.Background(), start.Add(50*time.Millisecond)); err != nil {
+		t.Error("unexpected error ", err)
+	}
+	checkTime(t, start, time.Now(), 45*time.Millisecond, 120*time.Millisecond)
+	if err := WaitUntil(ctx, time.Now().Add(time.Hour)); err != context.Canceled {
+		t.Error("wait must return the context error, got ", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	InitTiming(time.Millisecond, 50, _testDrv)
+	defer StopTiming()
+
+	errTest := errors.New("test")
+	if err := Timeout(context.Background(), time.Second, func(ctx context.Context) error {
+		return errTest
+	}); err != errTest {
+		t.Error("fn error must be returned, got ", err)
+	}
+
+	canceled := make(chan struct{})
+	start := time.Now()
+	err := Timeout(context.Background(), 50*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Error("expect deadline exceeded, got ", err)
+	}
+	checkTime(t, start, time.Now(), 45*time.Millisecond, 120*time.Millisecond)
+	<-canceled
+}
@@ -1,18 +1,97 @@
 package timing
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Timing interface {
 	Start()
 	Stop()
+	// AddTask runs task once delay has elapsed on the monotonic clock, so
+	// steps of the system clock do not move it.
 	AddTask(delay time.Duration, task func()) Timer
-	ScheduleTask(s Scheduler, task func()) Timer
+	// AddTaskAt is AddTask with an absolute deadline, converted to the
+	// monotonic clock with a single clock reading. A deadline that has already
+	// passed runs task immediately, as a non-positive delay does.
+	AddTaskAt(at time.Time, task func()) Timer
+	// AddWallTask runs task once the system clock reaches at. The timer follows
+	// steps of the system clock and runs at once if a step skips past at.
+	AddWallTask(at time.Time, task func()) Timer
+	ScheduleTask(s Scheduler, task func(), opts ...ScheduleOption) Timer
+	ScheduleTaskContext(s Scheduler, task func(ctx context.Context), opts ...ScheduleOption) Timer
+	// OnClockChange sets a hook that is called whenever a step of the system
+	// clock is detected, after wall timers have been re-evaluated.
+	OnClockChange(hook func(ClockChange))
+}
+
+// ClockChange describes a detected step of the system clock relative to the
+// monotonic clock.
+type ClockChange struct {
+	Step time.Duration
+	// Rescheduled counts the pending wall timers that were moved.
+	Rescheduled int
+	// Misfired counts the wall timers whose deadline the step skipped past;
+	// they run immediately.
+	Misfired int
 }
 
 type Scheduler interface {
 	Next(time.Time) time.Time
 }
 
+// Peeker is implemented by schedulers that keep state between runs, such as a
+// run count. Every call of Next schedules a run, while Peek returns what Next
+// would return without scheduling anything, so that callers probing for a
+// time can look ahead over times that will not run.
+type Peeker interface {
+	Peek(time.Time) time.Time
+}
+
+// Peek returns what s.Next(t) would return without scheduling a run. A
+// Scheduler that does not implement Peeker is taken to be stateless.
+func Peek(s Scheduler, t time.Time) time.Time {
+	if p, ok := s.(Peeker); ok {
+		return p.Peek(t)
+	}
+	return s.Next(t)
+}
+
+type TimerState int32
+
+const (
+	TimerPending TimerState = iota
+	TimerStopped
+	TimerRunning
+	TimerFired
+)
+
+func (s TimerState) String() string {
+	switch s {
+	case TimerPending:
+		return "pending"
+	case TimerStopped:
+		return "stopped"
+	case TimerRunning:
+		return "running"
+	case TimerFired:
+		return "fired"
+	}
+	return "unknown"
+}
+
 type Timer interface {
 	Stop() bool
+	// Reset moves the next run of the timer to d from now, re-arming it if it
+	// has fired or been stopped. It reports whether the timer was pending.
+	Reset(d time.Duration) bool
+	ResetAt(t time.Time) bool
+	// Deadline returns the time of the next run, or of the last one once the
+	// timer is no longer pending.
+	Deadline() time.Time
+	// Remaining returns the time left until the next run, 0 if none is pending.
+	Remaining() time.Duration
+	State() TimerState
+	// Done is closed once the timer is stopped or has run for the last time.
+	Done() <-chan struct{}
 }
@@ -3,36 +3,36 @@ package dqdriver
 import (
 	"sync"
 	"sync/atomic"
+	"unsafe"
 )
 
 type bucket struct {
 	expiration int64
 	mu         sync.Mutex
-	root       timer
-	last       *timer
+	root       timer // 哨兵节点，root.next为首元素，root.prev为尾元素
 }
 
 func newBucket() *bucket {
 	b := &bucket{
 		expiration: -1,
 	}
-	b.last = &b.root
+	b.root.next = &b.root
+	b.root.prev = &b.root
 	return b
 }
 
-func (b *bucket) removeFirst() {
-	rm := b.root.next
-	if rm == nil {
-		return
-	}
-	b.root.next = rm.next
-	rm.next = nil
-	if b.root.next == nil { // 移除的是最后一个元素
-		b.last = &b.root
-	}
+func (b *bucket) remove(t *timer) {
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.next = nil
+	t.prev = nil
+	atomic.StorePointer(&t.b, nil)
 }
 
 func (b *bucket) Front() *timer {
+	if b.root.next == &b.root {
+		return nil
+	}
 	return b.root.next
 }
 
@@ -44,29 +44,32 @@ func (b *bucket) SetExpiration(expiration int64) bool {
 	return atomic.SwapInt64(&b.expiration, expiration) != expiration
 }
 
-func (b *bucket) Add(t *timer) {
+// Add links t and sets the bucket expiration under the same lock, so that a
+// timer found in the bucket never expires before the bucket does.
+func (b *bucket) Add(t *timer, expiration int64) bool {
 	b.mu.Lock()
 
-	b.last.next = t
-	b.last = t
+	t.prev = b.root.prev
+	t.next = &b.root
+	b.root.prev.next = t
+	b.root.prev = t
+	atomic.StorePointer(&t.b, unsafe.Pointer(b))
+	set := b.SetExpiration(expiration)
 
 	b.mu.Unlock()
+	return set
 }
 
 func (b *bucket) Flush(reinsert func(*timer)) {
 	var ts []*timer
 
 	b.mu.Lock()
-	for t := b.Front(); t != nil; {
-		next := t.Next()
-
-		b.removeFirst()
+	for t := b.Front(); t != nil; t = b.Front() {
+		b.remove(t)
 
 		if !t.isStop() {
 			ts = append(ts, t)
 		}
-
-		t = next
 	}
 	b.SetExpiration(-1)
 	b.mu.Unlock()
@@ -0,0 +1,107 @@
+package dqdriver
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+const defaultClockCheck = 500 * time.Millisecond
+
+// now returns the current time of the wheel in nanoseconds. It advances with
+// the monotonic clock and is therefore not affected by steps of the system
+// clock; all timer expirations are kept on this timeline.
+func (tw *timingWheel) now() int64 {
+	return tw.base.Add(time.Since(tw.base)).UnixNano()
+}
+
+// fromTime converts a deadline to the wheel clock using one reading of the
+// system clock; a deadline carrying a monotonic reading is converted exactly.
+func (tw *timingWheel) fromTime(at time.Time) int64 {
+	now := time.Now()
+	return tw.base.Add(now.Sub(tw.base)).UnixNano() + int64(at.Sub(now))
+}
+
+func (tw *timingWheel) nowTime() time.Time {
+	return time.Unix(0, tw.now())
+}
+
+// offset returns how far the system clock is ahead of the wheel clock.
+func (tw *timingWheel) offset() int64 {
+	return tw.wall().UnixNano() - tw.now()
+}
+
+func (tw *timingWheel) fromWall(t time.Time) int64 {
+	return t.UnixNano() - tw.offset()
+}
+
+func (tw *timingWheel) toWall(expiration int64) time.Time {
+	return time.Unix(0, expiration+tw.offset())
+}
+
+func (tw *timingWheel) OnClockChange(hook func(timing.ClockChange)) {
+	tw.clockHook.Store(hook)
+}
+
+func (tw *timingWheel) registerWall(t *timer) {
+	tw.wallMu.Lock()
+	tw.wallTimers[t] = struct{}{}
+	tw.wallMu.Unlock()
+}
+
+func (tw *timingWheel) unregisterWall(t *timer) {
+	tw.wallMu.Lock()
+	delete(tw.wallTimers, t)
+	tw.wallMu.Unlock()
+}
+
+func (tw *timingWheel) watchClock() {
+	ticker := time.NewTicker(tw.clockCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tw.checkClock()
+		case <-tw.exitC:
+			return
+		}
+	}
+}
+
+// checkClock compares the system clock with the wheel clock and moves the
+// pending wall timers once they have drifted apart by more than a tick.
+func (tw *timingWheel) checkClock() {
+	now := tw.now()
+	offset := tw.wall().UnixNano() - now
+	old := atomic.LoadInt64(&tw.wallOffset)
+	step := offset - old
+	if step < tw.tick && step > -tw.tick {
+		return
+	}
+	atomic.StoreInt64(&tw.wallOffset, offset)
+
+	tw.wallMu.Lock()
+	ts := make([]*timer, 0, len(tw.wallTimers))
+	for t := range tw.wallTimers {
+		ts = append(ts, t)
+	}
+	tw.wallMu.Unlock()
+
+	change := timing.ClockChange{Step: time.Duration(step)}
+	for _, t := range ts {
+		wallAt := atomic.LoadInt64(&t.wallAt)
+		if !t.move(wallAt - offset) {
+			tw.unregisterWall(t)
+			continue
+		}
+		change.Rescheduled++
+		if wallAt-old > now && wallAt-offset <= now {
+			change.Misfired++
+		}
+	}
+
+	if hook, ok := tw.clockHook.Load().(func(timing.ClockChange)); ok && hook != nil {
+		hook(change)
+	}
+}
@@ -0,0 +1,104 @@
+package dqdriver
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+func newSkewedWheel() (*timingWheel, *int64) {
+	var skew int64
+	tw := NewTimingWheel(time.Millisecond, 50).(*timingWheel)
+	tw.wall = func() time.Time {
+		return time.Now().Add(time.Duration(atomic.LoadInt64(&skew)))
+	}
+	tw.clockCheck = 5 * time.Millisecond
+	return tw, &skew
+}
+
+func TestTimingWheel_ClockStep(t *testing.T) {
+	tw, skew := newSkewedWheel()
+	changes := make(chan timing.ClockChange, 4)
+	tw.OnClockChange(func(c timing.ClockChange) {
+		changes <- c
+	})
+	tw.Start()
+	defer tw.Stop()
+
+	fired := make(chan string, 4)
+	start := time.Now()
+	tw.AddTask(200*time.Millisecond, func() { fired <- "mono" })
+	wall := tw.AddWallTask(tw.wall().Add(200*time.Millisecond), func() { fired <- "wall" })
+	late := tw.AddWallTask(tw.wall().Add(time.Hour), func() { fired <- "late" })
+
+	time.Sleep(20 * time.Millisecond)
+	atomic.StoreInt64(skew, int64(100*time.Millisecond))
+
+	c := <-changes
+	if c.Step < 95*time.Millisecond || c.Step > 105*time.Millisecond || c.Rescheduled != 2 || c.Misfired != 0 {
+		t.Fatal("unexpected clock change ", c)
+	}
+	if r := wall.Remaining(); r > 100*time.Millisecond {
+		t.Fatal("wall timer must follow the clock step, remaining ", r)
+	}
+
+	if name := <-fired; name != "wall" {
+		t.Fatal("wall timer must fire first, got ", name)
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Fatal("wall timer fired late ", d)
+	}
+	if name := <-fired; name != "mono" {
+		t.Fatal("monotonic timer must not move, got ", name)
+	}
+	if d := time.Since(start); d < 195*time.Millisecond {
+		t.Fatal("monotonic timer fired early ", d)
+	}
+
+	atomic.StoreInt64(skew, int64(2*time.Hour))
+	c = <-changes
+	if c.Rescheduled != 1 || c.Misfired != 1 {
+		t.Fatal("skipped wall timer must be reported, got ", c)
+	}
+	select {
+	case name := <-fired:
+		if name != "late" {
+			t.Fatal("unexpected timer ", name)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("skipped wall timer must run immediately")
+	}
+	if late.State() != timing.TimerFired {
+		t.Fatal("skipped wall timer must be fired, got ", late.State())
+	}
+}
+
+func TestTimingWheel_ClockStepBackward(t *testing.T) {
+	tw, skew := newSkewedWheel()
+	tw.Start()
+	defer tw.Stop()
+
+	fired := make(chan struct{})
+	at := tw.wall().Add(50 * time.Millisecond)
+	timer := tw.AddWallTask(at, func() { close(fired) })
+	atomic.StoreInt64(skew, -int64(100*time.Millisecond))
+
+	select {
+	case <-fired:
+		t.Fatal("wall timer must wait for the clock to reach its deadline")
+	case <-time.After(100 * time.Millisecond):
+	}
+	select {
+	case <-fired:
+		if tw.wall().Before(at) {
+			t.Fatal("wall timer fired before its deadline")
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("delay run")
+	}
+	if !timer.Deadline().Equal(at) {
+		t.Fatal("wall timer deadline must be its wall time")
+	}
+}
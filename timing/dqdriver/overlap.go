@@ -0,0 +1,80 @@
+package dqdriver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+type overlapRunner struct {
+	task    func(ctx context.Context)
+	policy  timing.OverlapPolicy
+	mu      sync.Mutex
+	running bool
+	pending bool
+	gen     uint64
+	cancel  context.CancelFunc
+}
+
+func (r *overlapRunner) run() {
+	switch r.policy {
+	case timing.OverlapSkip:
+		r.mu.Lock()
+		if r.running {
+			r.mu.Unlock()
+			return
+		}
+		r.running = true
+		r.mu.Unlock()
+
+		r.task(context.Background())
+
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	case timing.OverlapQueue:
+		r.mu.Lock()
+		if r.running {
+			r.pending = true
+			r.mu.Unlock()
+			return
+		}
+		r.running = true
+		r.mu.Unlock()
+
+		for {
+			r.task(context.Background())
+
+			r.mu.Lock()
+			if !r.pending {
+				r.running = false
+				r.mu.Unlock()
+				return
+			}
+			r.pending = false
+			r.mu.Unlock()
+		}
+	case timing.OverlapCancel:
+		ctx, cancel := context.WithCancel(context.Background())
+		r.mu.Lock()
+		if r.cancel != nil {
+			r.cancel()
+		}
+		r.gen++
+		gen := r.gen
+		r.cancel = cancel
+		r.mu.Unlock()
+
+		r.task(ctx)
+
+		r.mu.Lock()
+		if r.gen == gen {
+			r.cancel = nil
+		}
+		r.mu.Unlock()
+		cancel()
+	default:
+		r.task(context.Background())
+	}
+}
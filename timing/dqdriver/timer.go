@@ -1,38 +1,214 @@
 package dqdriver
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"github.com/welllog/timewheel/timing"
 )
 
+const (
+	statePending = int32(timing.TimerPending)
+	stateStopped = int32(timing.TimerStopped)
+	stateRunning = int32(timing.TimerRunning)
+	stateFired   = int32(timing.TimerFired)
+)
+
+var closedchan = make(chan struct{})
+
+func init() {
+	close(closedchan)
+}
+
 type timer struct {
 	expiration int64
+	wallAt     int64 // 非0表示跟随系统时钟的timer
 	state      int32
+	periodic   bool // 周期任务由调度方决定何时结束
 	task       func()
+	tw         *timingWheel
+	mu         sync.Mutex     // 保护timer在桶之间的移动
+	b          unsafe.Pointer // *bucket, 所在的桶
 	next       *timer
+	prev       *timer
+	done       unsafe.Pointer // *chan struct{}, 按需创建
 }
 
 func (t *timer) Stop() bool {
-	return atomic.SwapInt32(&t.state, 1) == 0
+	for {
+		state := atomic.LoadInt32(&t.state)
+		if state == stateStopped || state == stateFired {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&t.state, state, stateStopped) {
+			if atomic.LoadInt64(&t.wallAt) != 0 {
+				t.tw.unregisterWall(t)
+			}
+			t.closeDone()
+			return state == statePending
+		}
+	}
 }
 
-func (t *timer) Next() *timer {
-	return t.next
+func (t *timer) Reset(d time.Duration) bool {
+	if atomic.LoadInt64(&t.wallAt) != 0 {
+		return t.ResetAt(t.tw.wall().Add(d))
+	}
+	return t.reset(t.tw.now() + int64(d))
+}
+
+func (t *timer) ResetAt(at time.Time) bool {
+	if atomic.LoadInt64(&t.wallAt) != 0 {
+		atomic.StoreInt64(&t.wallAt, at.UnixNano())
+		t.tw.registerWall(t)
+		return t.reset(t.tw.fromWall(at))
+	}
+	return t.reset(t.tw.fromTime(at))
+}
+
+func (t *timer) reset(expiration int64) bool {
+	if t.task == nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.relocate(expiration, true)
+}
+
+// move changes the expiration of a pending timer without re-arming it.
+func (t *timer) move(expiration int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if atomic.LoadInt32(&t.state) != statePending {
+		return false
+	}
+	t.relocate(expiration, false)
+	return true
+}
+
+// relocate must be called with t.mu held.
+func (t *timer) relocate(expiration int64, rearm bool) bool {
+	removed := false
+	if b := t.getBucket(); b != nil {
+		b.mu.Lock()
+		if t.getBucket() == b {
+			if expiration+t.tw.round >= b.Expiration() {
+				// 桶到期时会按新的过期时间重新插入，无需移动
+				atomic.StoreInt64(&t.expiration, expiration)
+				active := !rearm || t.rearm()
+				b.mu.Unlock()
+				return active
+			}
+			b.remove(t)
+			removed = true
+		}
+		b.mu.Unlock()
+	}
+
+	atomic.StoreInt64(&t.expiration, expiration)
+	if !removed && atomic.LoadInt32(&t.state) == statePending {
+		// 正在由Flush或周期调度重新插入，插入时会读取新的过期时间
+		return true
+	}
+	if !rearm && !removed {
+		return false
+	}
+
+	active := !rearm || t.rearm()
+	t.tw.addOrRun(t)
+	return active
+}
+
+// rearm makes the timer pending again and reports whether it already was.
+func (t *timer) rearm() bool {
+	for {
+		state := atomic.LoadInt32(&t.state)
+		if state == statePending {
+			return true
+		}
+		if atomic.CompareAndSwapInt32(&t.state, state, statePending) {
+			atomic.CompareAndSwapPointer(&t.done, unsafe.Pointer(&closedchan), nil)
+			return false
+		}
+	}
+}
+
+func (t *timer) Deadline() time.Time {
+	if wallAt := atomic.LoadInt64(&t.wallAt); wallAt != 0 {
+		return time.Unix(0, wallAt)
+	}
+	exp := atomic.LoadInt64(&t.expiration)
+	if exp == 0 {
+		return time.Time{}
+	}
+	return t.tw.toWall(exp)
+}
+
+func (t *timer) Remaining() time.Duration {
+	if atomic.LoadInt32(&t.state) != statePending {
+		return 0
+	}
+	d := time.Duration(atomic.LoadInt64(&t.expiration) - t.tw.now())
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (t *timer) State() timing.TimerState {
+	return timing.TimerState(atomic.LoadInt32(&t.state))
+}
+
+func (t *timer) Done() <-chan struct{} {
+	p := atomic.LoadPointer(&t.done)
+	if p == nil {
+		c := make(chan struct{})
+		if atomic.CompareAndSwapPointer(&t.done, nil, unsafe.Pointer(&c)) {
+			return c
+		}
+		p = atomic.LoadPointer(&t.done)
+	}
+	return *(*chan struct{})(p)
+}
+
+func (t *timer) closeDone() {
+	p := atomic.SwapPointer(&t.done, unsafe.Pointer(&closedchan))
+	if p != nil && p != unsafe.Pointer(&closedchan) {
+		close(*(*chan struct{})(p))
+	}
+}
+
+func (t *timer) getBucket() *bucket {
+	return (*bucket)(atomic.LoadPointer(&t.b))
 }
 
 func (t *timer) run(wrapper *timing.WaitGroupWrapper) bool {
-	if atomic.CompareAndSwapInt32(&t.state, 0, 2) {
-		wrapper.Wrap(t.task)
+	if atomic.CompareAndSwapInt32(&t.state, statePending, stateRunning) {
+		wrapper.Wrap(func() {
+			t.task()
+			if !t.periodic {
+				t.finish()
+			}
+		})
 		return true
 	}
 	return false
 }
 
+// finish marks a running timer as fired once its last run is over.
+func (t *timer) finish() {
+	if atomic.CompareAndSwapInt32(&t.state, stateRunning, stateFired) {
+		t.closeDone()
+	}
+}
+
 func (t *timer) resetState() bool {
-	return atomic.CompareAndSwapInt32(&t.state, 2, 0)
+	return atomic.CompareAndSwapInt32(&t.state, stateRunning, statePending)
 }
 
 func (t *timer) isStop() bool {
-	return atomic.LoadInt32(&t.state) == 1
+	return atomic.LoadInt32(&t.state) == stateStopped
 }
@@ -2,6 +2,7 @@ package dqdriver
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -13,6 +14,7 @@ type timingWheel struct {
 	tick          int64
 	slotNum       int64
 	interval      int64
+	round         int64 // 最底层时间轮tick-1, 见add
 	curTime       int64
 	slots         []*bucket
 	queue         timing.DelayQueue
@@ -20,17 +22,32 @@ type timingWheel struct {
 	overflowWheel unsafe.Pointer
 	exitC         chan struct{}
 	waitGroup     timing.WaitGroupWrapper
+
+	// 以下字段只在最底层时间轮中使用
+	base       time.Time        // 创建时刻，携带单调时钟读数
+	wall       func() time.Time // 系统时钟
+	wallOffset int64            // 最近一次检测到的系统时钟与单调时钟之差, 创建时为0
+	clockCheck time.Duration
+	clockHook  atomic.Value // func(timing.ClockChange)
+	wallMu     sync.Mutex
+	wallTimers map[*timer]struct{}
 }
 
 func NewTimingWheel(tick time.Duration, slotNum int) timing.Timing {
 	if tick < time.Millisecond {
 		panic("tick must be greater than or equal to 1ms")
 	}
-	return newTimingWheel(int64(tick), int64(slotNum), truncate(time.Now().UnixNano(), int64(tick)),
+	now := time.Now()
+	tw := newTimingWheel(int64(tick), int64(slotNum), int64(tick)-1, truncate(now.UnixNano(), int64(tick)),
 		timing.NewDelayQueue(slotNum, tick))
+	tw.base = now
+	tw.wall = time.Now
+	tw.clockCheck = defaultClockCheck
+	tw.wallTimers = make(map[*timer]struct{})
+	return tw
 }
 
-func newTimingWheel(tick, slotNum, curTime int64, dq timing.DelayQueue) *timingWheel {
+func newTimingWheel(tick, slotNum, round, curTime int64, dq timing.DelayQueue) *timingWheel {
 	buckets := make([]*bucket, slotNum)
 	for i := range buckets {
 		buckets[i] = newBucket()
@@ -39,6 +56,7 @@ func newTimingWheel(tick, slotNum, curTime int64, dq timing.DelayQueue) *timingW
 		tick:     tick,
 		slotNum:  slotNum,
 		interval: tick * slotNum,
+		round:    round,
 		curTime:  curTime,
 		slots:    buckets,
 		queue:    dq,
@@ -46,16 +64,20 @@ func newTimingWheel(tick, slotNum, curTime int64, dq timing.DelayQueue) *timingW
 	}
 }
 
+// add places t in the bucket covering its expiration rounded up to the next
+// tick of the lowest wheel, so that the bucket never expires before t does.
+// Timers therefore fire up to one tick late rather than up to one tick early,
+// as time.Timer never fires early either.
 func (tw *timingWheel) add(t *timer) bool {
 	curTime := atomic.LoadInt64(&tw.curTime)
-	if t.expiration < curTime+tw.tick {
+	expiration := atomic.LoadInt64(&t.expiration) + tw.round
+	if expiration < curTime+tw.tick {
 		return false
-	} else if t.expiration < curTime+tw.interval {
-		virtualID := t.expiration / tw.tick
+	} else if expiration < curTime+tw.interval {
+		virtualID := expiration / tw.tick
 		b := tw.slots[virtualID%tw.slotNum]
-		b.Add(t)
 
-		if b.SetExpiration(virtualID * tw.tick) {
+		if b.Add(t, virtualID*tw.tick) {
 			tw.queue.Offer(b, time.Unix(0, b.Expiration()))
 		}
 
@@ -66,7 +88,7 @@ func (tw *timingWheel) add(t *timer) bool {
 			if atomic.CompareAndSwapInt32(
 				&tw.set, 0, 1) {
 
-				overflowWheel = unsafe.Pointer(newTimingWheel(tw.interval, tw.slotNum, curTime, tw.queue))
+				overflowWheel = unsafe.Pointer(newTimingWheel(tw.interval, tw.slotNum, tw.round, curTime, tw.queue))
 				atomic.StorePointer(&tw.overflowWheel, overflowWheel)
 			} else {
 				for {
@@ -88,6 +110,16 @@ func (tw *timingWheel) addOrRun(t *timer) {
 	}
 }
 
+// reinsert re-adds a timer taken out of a flushed bucket, unless Reset or
+// Stop has dealt with it in the meantime.
+func (tw *timingWheel) reinsert(t *timer) {
+	t.mu.Lock()
+	if t.getBucket() == nil && atomic.LoadInt32(&t.state) == statePending {
+		tw.addOrRun(t)
+	}
+	t.mu.Unlock()
+}
+
 func (tw *timingWheel) advanceClock(expiration int64) {
 	curTime := atomic.LoadInt64(&tw.curTime)
 	if expiration >= curTime+tw.tick {
@@ -104,8 +136,9 @@ func (tw *timingWheel) advanceClock(expiration int64) {
 func (tw *timingWheel) Start() {
 	ctx, cancel := context.WithCancel(context.Background())
 	tw.waitGroup.Wrap(func() {
-		tw.queue.Poll(ctx, time.Now)
+		tw.queue.Poll(ctx, tw.nowTime)
 	})
+	tw.waitGroup.Wrap(tw.watchClock)
 
 	tw.waitGroup.Wrap(func() {
 		ch := tw.queue.Chan()
@@ -114,7 +147,7 @@ func (tw *timingWheel) Start() {
 			case elem := <-ch:
 				b := elem.(*bucket)
 				tw.advanceClock(b.Expiration())
-				b.Flush(tw.addOrRun)
+				b.Flush(tw.reinsert)
 			case <-tw.exitC:
 				cancel()
 				return
@@ -139,26 +172,87 @@ func (tw *timingWheel) Stop() {
 }
 
 func (tw *timingWheel) AddTask(delay time.Duration, task func()) timing.Timer {
-	t := &timer{task: task, expiration: time.Now().Add(delay).UnixNano()}
+	t := &timer{task: task, tw: tw, expiration: tw.now() + int64(delay)}
 	tw.addOrRun(t)
 	return t
 }
 
-func (tw *timingWheel) ScheduleTask(s timing.Scheduler, task func()) timing.Timer {
-	t := &timer{}
-	expiration := s.Next(time.Now())
+func (tw *timingWheel) AddTaskAt(at time.Time, task func()) timing.Timer {
+	t := &timer{task: task, tw: tw, expiration: tw.fromTime(at)}
+	tw.addOrRun(t)
+	return t
+}
+
+func (tw *timingWheel) AddWallTask(at time.Time, task func()) timing.Timer {
+	t := &timer{tw: tw, wallAt: at.UnixNano()}
+	t.task = func() {
+		tw.unregisterWall(t)
+		task()
+	}
+	t.expiration = tw.fromWall(at)
+	tw.registerWall(t)
+	tw.addOrRun(t)
+	return t
+}
+
+func (tw *timingWheel) ScheduleTask(s timing.Scheduler, task func(), opts ...timing.ScheduleOption) timing.Timer {
+	return tw.ScheduleTaskContext(s, func(context.Context) { task() }, opts...)
+}
+
+func (tw *timingWheel) ScheduleTaskContext(s timing.Scheduler, task func(ctx context.Context),
+	opts ...timing.ScheduleOption) timing.Timer {
+
+	o := timing.NewScheduleOptions(opts...)
+	t := &timer{tw: tw, periodic: true}
+	expiration := s.Next(tw.wall())
 	if expiration.IsZero() {
+		t.state = stateFired
+		t.closeDone()
 		return t
 	}
 
-	t.expiration = expiration.UnixNano()
-	t.task = func() {
-		task()
+	t.expiration = tw.fromWall(expiration)
+	scheduled := expiration
+	// reschedule arms the next run and reports whether there is one. The state
+	// is checked first so that a stopped timer does not use up a run of s.
+	reschedule := func() bool {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if atomic.LoadInt32(&t.state) != stateRunning {
+			return false
+		}
+		var nexpiration time.Time
+		if o.FixedRate {
+			nexpiration = nextFixedRate(s, scheduled, tw.wall(), o.Misfire)
+			scheduled = nexpiration
+		} else {
+			nexpiration = s.Next(tw.wall())
+		}
+		if nexpiration.IsZero() || !t.resetState() {
+			return false
+		}
+		atomic.StoreInt64(&t.expiration, tw.fromWall(nexpiration))
+		tw.addOrRun(t)
+		return true
+	}
 
-		nexpiration := s.Next(time.Now())
-		if !nexpiration.IsZero() && t.resetState() {
-			t.expiration = nexpiration.UnixNano()
-			tw.addOrRun(t)
+	if o.Overlap == timing.OverlapNone {
+		t.task = func() {
+			task(context.Background())
+			if !reschedule() {
+				t.finish()
+			}
+		}
+	} else {
+		r := &overlapRunner{task: task, policy: o.Overlap}
+		t.task = func() {
+			// 先安排下一次触发，本次任务的执行时长不再影响周期
+			last := !reschedule()
+			r.run()
+			// 只有没有安排下一次的那次执行才能结束timer
+			if last {
+				t.finish()
+			}
 		}
 	}
 	tw.addOrRun(t)
@@ -166,6 +260,46 @@ func (tw *timingWheel) ScheduleTask(s timing.Scheduler, task func()) timing.Time
 	return t
 }
 
+// nextFixedRate returns the run following prev, applying the misfire policy
+// when that run is already due. The missed runs are only peeked, and exactly
+// one run is scheduled on s, from the time that yields the returned one. The
+// result is always after prev; a scheduler that stops advancing ends the
+// schedule.
+func nextFixedRate(s timing.Scheduler, prev, now time.Time, misfire timing.MisfirePolicy) time.Time {
+	next := timing.Peek(s, prev)
+	if !next.IsZero() && !next.After(prev) {
+		// 调度器不再前进，改从当前时刻计算，仍不前进则结束
+		if next = s.Next(now); next.After(prev) {
+			return next
+		}
+		return time.Time{}
+	}
+	if next.IsZero() || next.After(now) || misfire == timing.MisfireFireAll {
+		return s.Next(prev)
+	}
+
+	from := prev // 得到next的探测时刻
+	for {
+		n := timing.Peek(s, next)
+		if n.IsZero() {
+			if misfire == timing.MisfireFireOnce {
+				return s.Next(from)
+			}
+			return n
+		}
+		if !n.After(next) { // 调度器不再前进，按错过一次处理
+			return s.Next(from)
+		}
+		if n.After(now) {
+			if misfire == timing.MisfireFireOnce {
+				return s.Next(from)
+			}
+			return s.Next(next)
+		}
+		from, next = next, n
+	}
+}
+
 func truncate(x, m int64) int64 {
 	if m <= 0 {
 		return x
@@ -0,0 +1,457 @@
+package dqdriver
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/welllog/timewheel/schedule"
+	"github.com/welllog/timewheel/timing"
+)
+
+type everyScheduler struct {
+	d time.Duration
+}
+
+func (s *everyScheduler) Next(now time.Time) time.Time {
+	return now.Add(s.d)
+}
+
+func TestNextFixedRate(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &everyScheduler{d: time.Second}
+
+	if next := nextFixedRate(s, base, base.Add(500*time.Millisecond), timing.MisfireSkip); !next.Equal(base.Add(time.Second)) {
+		t.Fatal("on time run must follow the previous scheduled time, got ", next.Sub(base))
+	}
+
+	now := base.Add(3500 * time.Millisecond)
+	cases := []struct {
+		misfire timing.MisfirePolicy
+		expect  time.Duration
+	}{
+		{timing.MisfireFireAll, time.Second},
+		{timing.MisfireFireOnce, 3 * time.Second},
+		{timing.MisfireSkip, 4 * time.Second},
+	}
+	for _, c := range cases {
+		next := nextFixedRate(s, base, now, c.misfire)
+		if !next.Equal(base.Add(c.expect)) {
+			t.Fatal("misfire ", c.misfire, " expect ", c.expect, " got ", next.Sub(base))
+		}
+	}
+}
+
+// constScheduler always returns the same time.
+type constScheduler struct {
+	at time.Time
+}
+
+func (s *constScheduler) Next(now time.Time) time.Time {
+	return s.at
+}
+
+func TestNextFixedRate_NotAdvancing(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &constScheduler{at: base}
+	for _, misfire := range []timing.MisfirePolicy{timing.MisfireFireOnce, timing.MisfireFireAll, timing.MisfireSkip} {
+		if next := nextFixedRate(s, base, base.Add(time.Second), misfire); !next.IsZero() {
+			t.Fatal("misfire ", misfire, " must end a schedule that does not advance, got ", next.Sub(base))
+		}
+	}
+
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	var runs int32
+	timer := tw.ScheduleTask(&constScheduler{at: time.Now().Add(5 * time.Millisecond)}, func() {
+		atomic.AddInt32(&runs, 1)
+	}, timing.FixedRate(timing.MisfireSkip))
+	select {
+	case <-timer.Done():
+	case <-time.After(time.Second):
+		t.Fatal("schedule did not end")
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Error("runs ", n)
+	}
+}
+
+func TestNextFixedRate_AlignDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 01:50 EST之后的02:05不存在，下一次应在03:05 EDT
+	prev := time.Date(2026, 3, 8, 6, 50, 0, 0, time.UTC)
+	s := schedule.Align(15*time.Minute, 5*time.Minute, ny)
+	next := nextFixedRate(s, prev, prev.Add(time.Second), timing.MisfireSkip)
+	if !next.Equal(time.Date(2026, 3, 8, 7, 5, 0, 0, time.UTC)) {
+		t.Fatal("expect 03:05 EDT, got ", next.In(ny))
+	}
+}
+
+func TestTimingWheel_ScheduleTaskFixedRate(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	done := make(chan struct{})
+	var runs int
+	start := time.Now()
+	timer := tw.ScheduleTask(&everyScheduler{d: 20 * time.Millisecond}, func() {
+		time.Sleep(10 * time.Millisecond)
+		runs++
+		if runs == 10 {
+			close(done)
+		}
+	}, timing.FixedRate(timing.MisfireSkip))
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		if elapsed := time.Since(start); elapsed > 260*time.Millisecond {
+			t.Error("fixed rate schedule drifted ", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delay run")
+	}
+}
+
+func TestTimingWheel_ScheduleTaskFixedRateLimit(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	for _, misfire := range []timing.MisfirePolicy{timing.MisfireFireAll, timing.MisfireFireOnce, timing.MisfireSkip} {
+		var runs int32
+		timer := tw.ScheduleTask(schedule.Limit(schedule.Every(10*time.Millisecond), 5), func() {
+			atomic.AddInt32(&runs, 1)
+			time.Sleep(35 * time.Millisecond)
+		}, timing.FixedRate(misfire))
+
+		select {
+		case <-timer.Done():
+		case <-time.After(time.Second):
+			t.Fatal("misfire ", misfire, " schedule did not finish")
+		}
+		if n := atomic.LoadInt32(&runs); n != 5 {
+			t.Error("misfire ", misfire, " expect 5 runs, got ", n)
+		}
+	}
+}
+
+func TestTimingWheel_ScheduleTaskOverlap(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	cases := []struct {
+		policy        timing.OverlapPolicy
+		maxConcurrent int32
+	}{
+		{timing.OverlapAllow, 2},
+		{timing.OverlapSkip, 1},
+		{timing.OverlapQueue, 1},
+		{timing.OverlapCancel, 2},
+	}
+	for _, c := range cases {
+		var running, max, runs, canceled int32
+		timer := tw.ScheduleTaskContext(&everyScheduler{d: 20 * time.Millisecond}, func(ctx context.Context) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			atomic.AddInt32(&runs, 1)
+
+			select {
+			case <-ctx.Done():
+				atomic.AddInt32(&canceled, 1)
+			case <-time.After(50 * time.Millisecond):
+			}
+			atomic.AddInt32(&running, -1)
+		}, timing.WithOverlap(c.policy))
+
+		time.Sleep(210 * time.Millisecond)
+		timer.Stop()
+		time.Sleep(60 * time.Millisecond)
+
+		if m := atomic.LoadInt32(&max); (c.maxConcurrent == 1 && m != 1) || (c.maxConcurrent > 1 && m < 2) {
+			t.Error("policy ", c.policy, " max concurrent runs ", m)
+		}
+		if c.policy == timing.OverlapCancel && atomic.LoadInt32(&canceled) == 0 {
+			t.Error("cancel policy must cancel the previous run")
+		}
+		if c.policy != timing.OverlapCancel && atomic.LoadInt32(&canceled) != 0 {
+			t.Error("policy ", c.policy, " must not cancel runs")
+		}
+		if c.policy == timing.OverlapQueue && atomic.LoadInt32(&runs) < 4 {
+			t.Error("queue policy must run back to back, runs ", atomic.LoadInt32(&runs))
+		}
+	}
+}
+
+// slowScheduler takes a while to compute the next run, which widens the gap
+// between a run starting and the following one being scheduled.
+type slowScheduler struct {
+	d time.Duration
+}
+
+func (s *slowScheduler) Next(now time.Time) time.Time {
+	time.Sleep(time.Millisecond)
+	return now.Add(s.d)
+}
+
+func TestTimingWheel_ScheduleTaskOverlapSlowScheduler(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	policies := []timing.OverlapPolicy{timing.OverlapAllow, timing.OverlapSkip, timing.OverlapQueue, timing.OverlapCancel}
+	for _, policy := range policies {
+		var runs int32
+		timer := tw.ScheduleTaskContext(&slowScheduler{d: 3 * time.Millisecond}, func(ctx context.Context) {
+			atomic.AddInt32(&runs, 1)
+			select {
+			case <-ctx.Done():
+			case <-time.After(3 * time.Millisecond):
+			}
+		}, timing.WithOverlap(policy))
+
+		time.Sleep(100 * time.Millisecond)
+		if st := timer.State(); st == timing.TimerFired {
+			t.Error("policy ", policy, " stopped after ", atomic.LoadInt32(&runs), " runs")
+		}
+		if n := atomic.LoadInt32(&runs); n < 5 {
+			t.Error("policy ", policy, " runs ", n)
+		}
+		timer.Stop()
+	}
+}
+
+func TestTimingWheel_ScheduleTaskStopKeepsRuns(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	s := &countScheduler{d: 5 * time.Millisecond, n: 100}
+	started, stopped := make(chan struct{}), make(chan struct{})
+	timer := tw.ScheduleTask(s, func() {
+		close(started)
+		<-stopped
+	})
+	<-started
+	timer.Stop()
+	close(stopped)
+	<-timer.Done()
+	time.Sleep(10 * time.Millisecond)
+
+	// 首次调度用掉一次，停止后的执行不能再消耗
+	if s.n != 99 {
+		t.Error("stopped timer used up runs, left ", s.n)
+	}
+}
+
+type countScheduler struct {
+	d time.Duration
+	n int
+}
+
+func (s *countScheduler) Next(now time.Time) time.Time {
+	if s.n == 0 {
+		return time.Time{}
+	}
+	s.n--
+	return now.Add(s.d)
+}
+
+func TestTimer_Introspection(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	start := time.Now()
+	run := make(chan struct{})
+	timer := tw.AddTask(100*time.Millisecond, func() {
+		<-run
+	})
+	if timer.State() != timing.TimerPending {
+		t.Fatal("new timer must be pending, got ", timer.State())
+	}
+	if d := timer.Deadline().Sub(start); d < 99*time.Millisecond || d > 110*time.Millisecond {
+		t.Fatal("unexpected deadline ", d)
+	}
+	if r := timer.Remaining(); r <= 0 || r > 100*time.Millisecond {
+		t.Fatal("unexpected remaining ", r)
+	}
+
+	done := timer.Done()
+	time.Sleep(150 * time.Millisecond)
+	if timer.State() != timing.TimerRunning || timer.Remaining() != 0 {
+		t.Fatal("timer must be running, got ", timer.State())
+	}
+	close(run)
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("done must be closed after the task returns")
+	}
+	if timer.State() != timing.TimerFired {
+		t.Fatal("timer must be fired, got ", timer.State())
+	}
+	if timer.Stop() || timer.State() != timing.TimerFired {
+		t.Fatal("stopping a fired timer must not change its state")
+	}
+
+	timer = tw.AddTask(100*time.Millisecond, func() {})
+	if !timer.Stop() || timer.State() != timing.TimerStopped {
+		t.Fatal("timer must be stopped")
+	}
+	select {
+	case <-timer.Done():
+	default:
+		t.Fatal("done must be closed after stop")
+	}
+
+	timer = tw.ScheduleTask(&countScheduler{d: 10 * time.Millisecond, n: 3}, func() {})
+	select {
+	case <-timer.Done():
+		if timer.State() != timing.TimerFired {
+			t.Fatal("exhausted schedule must be fired, got ", timer.State())
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("done must be closed after the last run")
+	}
+
+	timer = tw.ScheduleTask(&countScheduler{}, func() {})
+	if timer.State() != timing.TimerFired {
+		t.Fatal("empty schedule must be fired, got ", timer.State())
+	}
+	<-timer.Done()
+}
+
+func TestTimer_Reset(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	fired := make(chan time.Time, 4)
+	task := func() { fired <- time.Now() }
+
+	// 延后: 桶到期后按新的过期时间重新插入
+	start := time.Now()
+	timer := tw.AddTask(30*time.Millisecond, task)
+	if !timer.Reset(80 * time.Millisecond) {
+		t.Fatal("reset of a pending timer must report true")
+	}
+	select {
+	case at := <-fired:
+		if d := at.Sub(start); d < 75*time.Millisecond || d > 120*time.Millisecond {
+			t.Fatal("extended timer fired after ", d)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("extended timer did not fire")
+	}
+
+	// 提前: 从原来的桶中移除
+	start = time.Now()
+	timer = tw.AddTask(2*time.Second, task)
+	timer.Reset(30 * time.Millisecond)
+	select {
+	case at := <-fired:
+		if d := at.Sub(start); d < 25*time.Millisecond || d > 80*time.Millisecond {
+			t.Fatal("shortened timer fired after ", d)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("shortened timer did not fire")
+	}
+	<-timer.Done()
+	if timer.State() != timing.TimerFired {
+		t.Fatal("timer must be fired, got ", timer.State())
+	}
+
+	// 已触发与已停止的timer重新计时
+	if timer.Reset(20 * time.Millisecond) {
+		t.Fatal("reset of a fired timer must report false")
+	}
+	if timer.State() != timing.TimerPending {
+		t.Fatal("reset timer must be pending, got ", timer.State())
+	}
+	<-fired
+	timer.Stop()
+	timer.ResetAt(time.Now().Add(20 * time.Millisecond))
+	select {
+	case <-fired:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("stopped timer did not fire after reset")
+	}
+	select {
+	case <-fired:
+		t.Fatal("timer fired twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTimer_ResetConcurrent(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	defer tw.Stop()
+
+	var runs int32
+	timers := make([]timing.Timer, 200)
+	for i := range timers {
+		timers[i] = tw.AddTask(time.Duration(i%40)*time.Millisecond, func() {
+			atomic.AddInt32(&runs, 1)
+		})
+	}
+
+	stop := time.Now().Add(100 * time.Millisecond)
+	for time.Now().Before(stop) {
+		for i, timer := range timers {
+			timer.Reset(time.Duration(10+i%30) * time.Millisecond)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, timer := range timers {
+		if timer.State() != timing.TimerFired {
+			t.Fatal("every timer must fire after the last reset, got ", timer.State())
+		}
+	}
+}
+
+func TestTimingWheel_AddTaskAt(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	fired := make(chan time.Time, 2)
+	task := func() { fired <- time.Now() }
+
+	deadline := time.Now().Add(50 * time.Millisecond)
+	timer := tw.AddTaskAt(deadline, task)
+	if d := timer.Deadline().Sub(deadline); d < -time.Millisecond || d > time.Millisecond {
+		t.Fatal("unexpected deadline ", timer.Deadline())
+	}
+	if at := <-fired; at.Before(deadline) {
+		t.Fatal("run ahead")
+	}
+
+	start := time.Now()
+	tw.AddTaskAt(start.Add(-time.Hour), task)
+	if at := <-fired; at.Sub(start) > 10*time.Millisecond {
+		t.Fatal("past deadline must run immediately")
+	}
+
+	deadline = time.Now().Add(30 * time.Millisecond)
+	timer.ResetAt(deadline)
+	if at := <-fired; at.Before(deadline) {
+		t.Fatal("run ahead after ResetAt")
+	}
+}
@@ -0,0 +1,65 @@
+package timing
+
+// MisfirePolicy decides what a fixed-rate schedule does with runs whose
+// scheduled time has already passed, e.g. after the process was suspended
+// or a run overran its period.
+type MisfirePolicy int
+
+const (
+	// MisfireFireOnce runs once for all missed times, then continues on schedule.
+	MisfireFireOnce MisfirePolicy = iota
+	// MisfireFireAll runs once for every missed time, back to back.
+	MisfireFireAll
+	// MisfireSkip drops missed times and waits for the next one in the future.
+	MisfireSkip
+)
+
+// OverlapPolicy decides what a periodic task does when its next run is due
+// while the previous run is still executing.
+type OverlapPolicy int
+
+const (
+	// OverlapNone schedules the next run only after the previous one returns.
+	OverlapNone OverlapPolicy = iota
+	// OverlapAllow runs concurrently with the previous run.
+	OverlapAllow
+	// OverlapSkip drops the run if the previous one is still executing.
+	OverlapSkip
+	// OverlapQueue keeps at most one pending run until the previous one returns.
+	OverlapQueue
+	// OverlapCancel cancels the previous run's context and starts a new run.
+	OverlapCancel
+)
+
+type ScheduleOptions struct {
+	// FixedRate computes the next run from the previous scheduled time instead
+	// of from the time the previous run finished.
+	FixedRate bool
+	Misfire   MisfirePolicy
+	// Overlap other than OverlapNone schedules the next run as soon as the
+	// current one fires, so that runs may overlap.
+	Overlap OverlapPolicy
+}
+
+type ScheduleOption func(*ScheduleOptions)
+
+func NewScheduleOptions(opts ...ScheduleOption) ScheduleOptions {
+	var o ScheduleOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func FixedRate(misfire MisfirePolicy) ScheduleOption {
+	return func(o *ScheduleOptions) {
+		o.FixedRate = true
+		o.Misfire = misfire
+	}
+}
+
+func WithOverlap(policy OverlapPolicy) ScheduleOption {
+	return func(o *ScheduleOptions) {
+		o.Overlap = policy
+	}
+}
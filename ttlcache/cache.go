@@ -0,0 +1,220 @@
+// Package ttlcache provides a concurrent key/value cache whose entries expire
+// on a timing wheel.
+package ttlcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+)
+
+type EvictReason int
+
+const (
+	// EvictExpired means the TTL of the entry passed.
+	EvictExpired EvictReason = iota
+	// EvictCapacity means the entry was the least recently used one when the
+	// cache grew past MaxEntries.
+	EvictCapacity
+	// EvictDeleted means the entry was removed by Delete.
+	EvictDeleted
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// Config configures a Cache. Zero TTL and zero MaxEntries mean no limit.
+type Config struct {
+	// TTL is the lifetime of entries added by Set.
+	TTL        time.Duration
+	MaxEntries int
+	// OnEvict is called, outside of any lock, for every entry leaving the
+	// cache.
+	OnEvict func(key, value interface{}, reason EvictReason)
+}
+
+type entry struct {
+	key, value interface{}
+	ttl        time.Duration
+	expireAt   time.Time
+	timer      timing.Timer
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return e.ttl > 0 && !now.Before(e.expireAt)
+}
+
+type eviction struct {
+	e      *entry
+	reason EvictReason
+}
+
+// Cache keeps one wheel timer per entry with a TTL and reuses it on Touch
+// and on Set of an existing key.
+type Cache struct {
+	timing timing.Timing
+	cfg    Config
+
+	mu    sync.Mutex
+	items map[interface{}]*list.Element
+	lru   *list.List // 头部为最近使用
+}
+
+func New(tw timing.Timing, cfg Config) *Cache {
+	return &Cache{
+		timing: tw,
+		cfg:    cfg,
+		items:  make(map[interface{}]*list.Element),
+		lru:    list.New(),
+	}
+}
+
+// Set stores value under key with the TTL of the Config.
+func (c *Cache) Set(key, value interface{}) {
+	c.SetWithTTL(key, value, c.cfg.TTL)
+}
+
+// SetWithTTL stores value under key, expiring after ttl. A non-positive ttl
+// keeps the entry until it is deleted or evicted for capacity.
+func (c *Cache) SetWithTTL(key, value interface{}, ttl time.Duration) {
+	var evicted []eviction
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value = value
+		c.lru.MoveToFront(el)
+		c.arm(e, ttl)
+	} else {
+		e := &entry{key: key, value: value}
+		c.items[key] = c.lru.PushFront(e)
+		c.arm(e, ttl)
+
+		for c.cfg.MaxEntries > 0 && c.lru.Len() > c.cfg.MaxEntries {
+			evicted = append(evicted, eviction{e: c.removeLocked(c.lru.Back()), reason: EvictCapacity})
+		}
+	}
+	c.mu.Unlock()
+
+	c.notify(evicted...)
+}
+
+// Get returns the value stored under key and marks it as recently used.
+func (c *Cache) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if e.expired(time.Now()) { // timer即将触发
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.value, true
+}
+
+// Touch restarts the TTL of the entry under key and reports whether it was
+// present.
+func (c *Cache) Touch(key interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	e := el.Value.(*entry)
+	if e.expired(time.Now()) {
+		return false
+	}
+	c.lru.MoveToFront(el)
+	c.arm(e, e.ttl)
+	return true
+}
+
+// Delete removes the entry under key, stops its timer and reports whether it
+// was present.
+func (c *Cache) Delete(key interface{}) bool {
+	c.mu.Lock()
+	el, ok := c.items[key]
+	var e *entry
+	if ok {
+		e = c.removeLocked(el)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.notify(eviction{e: e, reason: EvictDeleted})
+	}
+	return ok
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// arm starts the TTL of e. It must be called with c.mu held.
+func (c *Cache) arm(e *entry, ttl time.Duration) {
+	e.ttl = ttl
+	if ttl <= 0 {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		return
+	}
+
+	e.expireAt = time.Now().Add(ttl)
+	if e.timer == nil {
+		e.timer = c.timing.AddTask(ttl, func() {
+			c.expire(e)
+		})
+		return
+	}
+	e.timer.Reset(ttl)
+}
+
+func (c *Cache) expire(e *entry) {
+	c.mu.Lock()
+	el, ok := c.items[e.key]
+	// 已被删除、替换，或在触发期间被Touch重新计时
+	if !ok || el.Value.(*entry) != e || !e.expired(time.Now()) {
+		c.mu.Unlock()
+		return
+	}
+	c.removeLocked(el)
+	c.mu.Unlock()
+
+	c.notify(eviction{e: e, reason: EvictExpired})
+}
+
+func (c *Cache) removeLocked(el *list.Element) *entry {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.items, e.key)
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	return e
+}
+
+func (c *Cache) notify(evicted ...eviction) {
+	if c.cfg.OnEvict == nil {
+		return
+	}
+	for _, ev := range evicted {
+		c.cfg.OnEvict(ev.e.key, ev.e.value, ev.reason)
+	}
+}
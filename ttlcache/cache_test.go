@@ -0,0 +1,121 @@
+package ttlcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing"
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+type evictLog struct {
+	mu      sync.Mutex
+	reasons map[interface{}]EvictReason
+}
+
+func (l *evictLog) onEvict(key, value interface{}, reason EvictReason) {
+	l.mu.Lock()
+	l.reasons[key] = reason
+	l.mu.Unlock()
+}
+
+func (l *evictLog) get(key interface{}) (EvictReason, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.reasons[key]
+	return r, ok
+}
+
+func TestCache_Expire(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	log := &evictLog{reasons: make(map[interface{}]EvictReason)}
+	c := New(tw, Config{TTL: 30 * time.Millisecond, OnEvict: log.onEvict})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.SetWithTTL("c", 3, 100*time.Millisecond)
+	c.SetWithTTL("d", 4, 0)
+
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatal("unexpected value ", v)
+	}
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if !c.Touch("b") {
+			t.Fatal("touch of a live entry must report true")
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("entry must expire after its TTL")
+	}
+	if r, ok := log.get("a"); !ok || r != EvictExpired {
+		t.Fatal("expect expired eviction, got ", r)
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Fatal("touched entry must not expire")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Fatal("per-entry TTL must be kept")
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if _, ok := c.Get("c"); ok || c.Len() != 1 {
+		t.Fatal("entries must expire, left ", c.Len())
+	}
+	if _, ok := c.Get("d"); !ok {
+		t.Fatal("entry without TTL must not expire")
+	}
+}
+
+func TestCache_Capacity(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	log := &evictLog{reasons: make(map[interface{}]EvictReason)}
+	c := New(tw, Config{TTL: time.Minute, MaxEntries: 2, OnEvict: log.onEvict})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("least recently used entry must be evicted")
+	}
+	if r, ok := log.get("b"); !ok || r != EvictCapacity {
+		t.Fatal("expect capacity eviction, got ", r)
+	}
+	if _, ok := c.Get("a"); !ok || c.Len() != 2 {
+		t.Fatal("recently used entry must be kept")
+	}
+}
+
+func TestCache_Delete(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	log := &evictLog{reasons: make(map[interface{}]EvictReason)}
+	c := New(tw, Config{TTL: 30 * time.Millisecond, OnEvict: log.onEvict})
+	c.Set("a", 1)
+	timer := c.items["a"].Value.(*entry).timer
+
+	if !c.Delete("a") || c.Delete("a") {
+		t.Fatal("delete must report whether the entry was present")
+	}
+	if timer.State() != timing.TimerStopped {
+		t.Fatal("delete must stop the timer, got ", timer.State())
+	}
+	if r, ok := log.get("a"); !ok || r != EvictDeleted {
+		t.Fatal("expect deleted eviction, got ", r)
+	}
+	if c.Touch("a") {
+		t.Fatal("touch of a missing entry must report false")
+	}
+}
@@ -0,0 +1,146 @@
+package window
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultAccuracy = 0.01
+
+type sketch struct {
+	counts map[int]uint64
+	zero   uint64 // 非正数的个数
+	n      uint64
+}
+
+// Histogram estimates quantiles of the values observed over a sliding window
+// with a log-bucketed sketch: every quantile is within the relative accuracy
+// of a value that was observed. Values that are not positive are counted as
+// zero.
+type Histogram struct {
+	r       *Rotator
+	gamma   float64
+	lnGamma float64
+	born    int64
+	created time.Time
+
+	mu      sync.Mutex
+	buckets []sketch
+}
+
+// NewHistogram returns a histogram covering window with the given relative
+// accuracy, 1% if accuracy is not in (0, 1).
+func (r *Rotator) NewHistogram(window time.Duration, accuracy float64) *Histogram {
+	if accuracy <= 0 || accuracy >= 1 {
+		accuracy = defaultAccuracy
+	}
+	gamma := (1 + accuracy) / (1 - accuracy)
+	h := &Histogram{
+		r:       r,
+		gamma:   gamma,
+		lnGamma: math.Log(gamma),
+		buckets: make([]sketch, r.size(window)),
+		created: time.Now(),
+	}
+	for i := range h.buckets {
+		h.buckets[i].counts = make(map[int]uint64)
+	}
+	h.born = r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	tick := atomic.LoadInt64(&h.r.tick)
+	h.mu.Lock()
+	s := &h.buckets[tick%int64(len(h.buckets))]
+	if v > 0 {
+		s.counts[int(math.Ceil(math.Log(v)/h.lnGamma))]++
+	} else {
+		s.zero++
+	}
+	s.n++
+	h.mu.Unlock()
+}
+
+// Count returns the number of values observed over the last d, the whole
+// window if d is not positive or longer than the window.
+func (h *Histogram) Count(d time.Duration) uint64 {
+	tick, k, _ := h.r.span(d, len(h.buckets), h.born, h.created)
+	size := int64(len(h.buckets))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var n uint64
+	for i := int64(0); i <= int64(k); i++ {
+		n += h.buckets[(tick-i)%size].n
+	}
+	return n
+}
+
+// Quantile returns the q-quantile, q in [0, 1], of the values observed over
+// the last d, or 0 if there were none.
+func (h *Histogram) Quantile(q float64, d time.Duration) float64 {
+	tick, k, _ := h.r.span(d, len(h.buckets), h.born, h.created)
+	size := int64(len(h.buckets))
+
+	merged := make(map[int]uint64)
+	var zero, n uint64
+	h.mu.Lock()
+	for i := int64(0); i <= int64(k); i++ {
+		s := &h.buckets[(tick-i)%size]
+		for idx, c := range s.counts {
+			merged[idx] += c
+		}
+		zero += s.zero
+		n += s.n
+	}
+	h.mu.Unlock()
+
+	if n == 0 {
+		return 0
+	}
+	if q < 0 {
+		q = 0
+	} else if q > 1 {
+		q = 1
+	}
+	rank := uint64(q * float64(n-1))
+	if rank < zero {
+		return 0
+	}
+
+	keys := make([]int, 0, len(merged))
+	for idx := range merged {
+		keys = append(keys, idx)
+	}
+	sort.Ints(keys)
+
+	seen := zero
+	for _, idx := range keys {
+		seen += merged[idx]
+		if seen > rank {
+			return 2 * math.Pow(h.gamma, float64(idx)) / (h.gamma + 1)
+		}
+	}
+	return 2 * math.Pow(h.gamma, float64(keys[len(keys)-1])) / (h.gamma + 1)
+}
+
+// Close detaches the histogram from its rotator.
+func (h *Histogram) Close() {
+	h.r.unregister(h)
+}
+
+func (h *Histogram) rotate(tick int64) {
+	h.mu.Lock()
+	s := &h.buckets[tick%int64(len(h.buckets))]
+	if s.n > 0 {
+		for idx := range s.counts {
+			delete(s.counts, idx)
+		}
+		s.zero, s.n = 0, 0
+	}
+	h.mu.Unlock()
+}
@@ -0,0 +1,160 @@
+// Package window provides sliding-window counters and percentile sketches
+// whose buckets are rotated by a shared wheel schedule, so that recording a
+// value never reads the clock.
+package window
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/welllog/timewheel/schedule"
+	"github.com/welllog/timewheel/timing"
+)
+
+type rotatable interface {
+	// rotate clears the bucket of the given tick before it becomes current.
+	rotate(tick int64)
+}
+
+// Rotator advances the buckets of all its windows once per resolution from a
+// single ScheduleTask timer.
+type Rotator struct {
+	resolution time.Duration
+	timer      timing.Timer
+
+	tick       int64 // 当前桶的序号
+	lastRotate int64 // 最近一次轮转的UnixNano
+
+	mu      sync.RWMutex
+	windows map[rotatable]struct{}
+}
+
+// NewRotator starts rotating buckets of length resolution on tw.
+func NewRotator(tw timing.Timing, resolution time.Duration) *Rotator {
+	r := &Rotator{
+		resolution: resolution,
+		lastRotate: time.Now().UnixNano(),
+		windows:    make(map[rotatable]struct{}),
+	}
+	r.timer = tw.ScheduleTask(schedule.Every(resolution), r.rotate, timing.FixedRate(timing.MisfireFireAll))
+	return r
+}
+
+// Stop stops the rotation; the windows keep their last buckets.
+func (r *Rotator) Stop() {
+	r.timer.Stop()
+}
+
+func (r *Rotator) rotate() {
+	r.mu.RLock()
+	next := atomic.LoadInt64(&r.tick) + 1
+	for w := range r.windows {
+		w.rotate(next)
+	}
+	atomic.StoreInt64(&r.lastRotate, time.Now().UnixNano())
+	atomic.StoreInt64(&r.tick, next)
+	r.mu.RUnlock()
+}
+
+func (r *Rotator) register(w rotatable) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.windows[w] = struct{}{}
+	return atomic.LoadInt64(&r.tick)
+}
+
+func (r *Rotator) unregister(w rotatable) {
+	r.mu.Lock()
+	delete(r.windows, w)
+	r.mu.Unlock()
+}
+
+// size returns the number of buckets of a window: the complete ones covering
+// window plus the current one.
+func (r *Rotator) size(window time.Duration) int {
+	n := int((window + r.resolution - 1) / r.resolution)
+	if n < 1 {
+		n = 1
+	}
+	return n + 1
+}
+
+// span returns the tick of the current bucket, the number of complete buckets
+// to read for the last d, at most size-1 and no more than the window has
+// lived through, and the time those buckets plus the current one cover.
+func (r *Rotator) span(d time.Duration, size int, born int64, created time.Time) (int64, int, time.Duration) {
+	tick := atomic.LoadInt64(&r.tick)
+	k := size - 1
+	if d > 0 {
+		if n := int((d + r.resolution - 1) / r.resolution); n < k {
+			k = n
+		}
+	}
+	if age := int(tick - born); age < k {
+		k = age
+	}
+
+	var current time.Duration
+	if tick == born {
+		current = time.Since(created)
+	} else {
+		current = time.Since(time.Unix(0, atomic.LoadInt64(&r.lastRotate)))
+	}
+	return tick, k, time.Duration(k)*r.resolution + current
+}
+
+// Counter sums the values added over a sliding window.
+type Counter struct {
+	r       *Rotator
+	buckets []int64
+	born    int64
+	created time.Time
+}
+
+// NewCounter returns a counter covering window.
+func (r *Rotator) NewCounter(window time.Duration) *Counter {
+	c := &Counter{r: r, buckets: make([]int64, r.size(window)), created: time.Now()}
+	c.born = r.register(c)
+	return c
+}
+
+func (c *Counter) Add(n int64) {
+	tick := atomic.LoadInt64(&c.r.tick)
+	atomic.AddInt64(&c.buckets[tick%int64(len(c.buckets))], n)
+}
+
+// Sum returns the total added over the last d, the whole window if d is not
+// positive or longer than the window.
+func (c *Counter) Sum(d time.Duration) int64 {
+	sum, _ := c.sum(d)
+	return sum
+}
+
+// Rate returns the per-second rate of the values added over the last d.
+func (c *Counter) Rate(d time.Duration) float64 {
+	sum, elapsed := c.sum(d)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(sum) / elapsed.Seconds()
+}
+
+// Close detaches the counter from its rotator.
+func (c *Counter) Close() {
+	c.r.unregister(c)
+}
+
+func (c *Counter) sum(d time.Duration) (int64, time.Duration) {
+	tick, k, elapsed := c.r.span(d, len(c.buckets), c.born, c.created)
+	size := int64(len(c.buckets))
+	var sum int64
+	for i := int64(0); i <= int64(k); i++ {
+		sum += atomic.LoadInt64(&c.buckets[(tick-i)%size])
+	}
+	return sum, elapsed
+}
+
+func (c *Counter) rotate(tick int64) {
+	atomic.StoreInt64(&c.buckets[tick%int64(len(c.buckets))], 0)
+}
@@ -0,0 +1,80 @@
+package window
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/welllog/timewheel/timing/dqdriver"
+)
+
+func TestCounter(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	r := NewRotator(tw, 10*time.Millisecond)
+	defer r.Stop()
+
+	c := r.NewCounter(50 * time.Millisecond)
+	other := r.NewCounter(time.Second)
+	for i := 0; i < 10; i++ {
+		c.Add(10)
+		other.Add(1)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if s := c.Sum(0); s != 100 {
+		t.Fatal("expect sum 100, got ", s)
+	}
+	if s := c.Sum(10 * time.Millisecond); s <= 0 || s >= 100 {
+		t.Fatal("sum over part of the window must be partial, got ", s)
+	}
+	if rate := c.Rate(0); rate < 1000 || rate > 3000 {
+		t.Fatal("unexpected rate ", rate)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if s := c.Sum(0); s != 0 {
+		t.Fatal("values must slide out of the window, got ", s)
+	}
+	if s := other.Sum(0); s != 10 {
+		t.Fatal("longer window must keep its values, got ", s)
+	}
+
+	c.Close()
+	other.Close()
+	if len(r.windows) != 0 {
+		t.Fatal("closed windows must be unregistered")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tw := dqdriver.NewTimingWheel(time.Millisecond, 50)
+	tw.Start()
+	defer tw.Stop()
+
+	r := NewRotator(tw, 10*time.Millisecond)
+	defer r.Stop()
+
+	h := r.NewHistogram(100*time.Millisecond, 0.01)
+	for i := 1; i <= 1000; i++ {
+		h.Observe(float64(i))
+	}
+	h.Observe(0)
+	if n := h.Count(0); n != 1001 {
+		t.Fatal("expect 1001 values, got ", n)
+	}
+	for _, c := range []struct{ q, expect float64 }{{0.5, 500}, {0.9, 900}, {0.99, 990}, {1, 1000}} {
+		if v := h.Quantile(c.q, 0); math.Abs(v-c.expect)/c.expect > 0.02 {
+			t.Fatal("quantile ", c.q, " expect ", c.expect, " got ", v)
+		}
+	}
+	if v := h.Quantile(0, 0); v != 0 {
+		t.Fatal("non-positive values must count as zero, got ", v)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if n := h.Count(0); n != 0 || h.Quantile(0.5, 0) != 0 {
+		t.Fatal("values must slide out of the window, left ", n)
+	}
+}